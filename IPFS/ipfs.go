@@ -1,96 +1,218 @@
 package ipfs
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"strings"
 
 	shell "github.com/ipfs/go-ipfs-api"
 )
 
-// IPFSManager manages connections to the IPFS API.
+// IPFSManager manages connections to one or more IPFS nodes and gateways.
 type IPFSManager struct {
-	Shell *shell.Shell
+	Shell    *shell.Shell // first configured node
+	nodes    []*Node
+	gateways []*Gateway
+	config   Config
+	stop     chan struct{}
 }
 
 // Manager is a globally accessible instance of IPFSManager.
 var Manager *IPFSManager
 
-// InitManager initializes the global Manager instance.
-func InitManager(url string) error {
+// InitManager initializes the global Manager instance and starts health checks.
+func InitManager(config Config) error {
+	if len(config.APIURLs) == 0 {
+		return fmt.Errorf("at least one IPFS API URL is required")
+	}
+	if config.Retries < 1 {
+		config.Retries = 1
+	}
+	if config.ReadDeadline <= 0 {
+		config.ReadDeadline = DefaultConfig().ReadDeadline
+	}
+
+	m := &IPFSManager{config: config, stop: make(chan struct{})}
+	for _, url := range config.APIURLs {
+		m.nodes = append(m.nodes, newNode(url, config.Timeout))
+	}
+	for _, url := range config.GatewayURLs {
+		m.gateways = append(m.gateways, newGateway(url, config.Timeout))
+	}
+	m.Shell = m.nodes[0].Shell
 
-	Manager = &IPFSManager{Shell: shell.NewShell(url)}
+	m.CheckHealth()
+	m.StartHealthChecks()
+
+	log.Printf("IPFS manager initialized with %d node(s) and %d gateway(s)", len(m.nodes), len(m.gateways))
+	Manager = m
 	return nil
 }
 
-// GetVersion retrieves and prints the IPFS node version.
+// GetVersion retrieves and prints the version of every IPFS node.
 func GetVersion() {
 	if Manager == nil {
 		log.Fatal("IPFS Manager is not initialized")
 	}
 
-	version, commit, err := Manager.Shell.Version() // FIX: Now correctly handling 3 return values
-	if err != nil {
-		log.Fatalf("Error getting version: %v", err)
+	for _, n := range Manager.nodes {
+		version, commit, err := n.Shell.Version()
+		if err != nil {
+			log.Printf("Error getting version from %s: %v", n.URL(), err)
+			continue
+		}
+		fmt.Printf("IPFS Node %s Version: %s (Commit: %s)\n", n.URL(), version, commit)
 	}
-	fmt.Printf("IPFS Node Version: %s (Commit: %s)\n", version, commit)
 }
 
+// PutFile adds data to every healthy primary node and returns its CID.
 func PutFile(data string) (string, error) {
 	if Manager == nil {
 		log.Fatal("IPFS Manager is not initialized")
 	}
 
-	r := strings.NewReader(data)
-
-	hash, err := Manager.Shell.Add(r)
+	var hash string
+	err := Manager.retry("add", func() error {
+		var errs []string
+		for _, n := range Manager.writeNodes() {
+			h, err := n.Shell.Add(strings.NewReader(data))
+			if err != nil {
+				n.SetHealthy(false)
+				errs = append(errs, fmt.Sprintf("%s: %v", n.URL(), err))
+				continue
+			}
+			hash = h
+		}
+		if hash == "" {
+			return fmt.Errorf("no node accepted the write: %s", strings.Join(errs, "; "))
+		}
+		return nil
+	})
 	if err != nil {
 		return "", err
 	}
 	return hash, nil
 }
 
-func GetFile(hash string) (string, error) {
+// HashFile returns the CID data would be added under, without storing it.
+func HashFile(data string) (string, error) {
 	if Manager == nil {
 		log.Fatal("IPFS Manager is not initialized")
 	}
-	r, err := Manager.Shell.Cat(hash)
+
+	var hash string
+	err := Manager.retry("hash", func() error {
+		var errs []string
+		for _, n := range Manager.writeNodes() {
+			h, err := n.Shell.Add(strings.NewReader(data), shell.OnlyHash(true))
+			if err != nil {
+				n.SetHealthy(false)
+				errs = append(errs, fmt.Sprintf("%s: %v", n.URL(), err))
+				continue
+			}
+			hash = h
+			return nil
+		}
+		return fmt.Errorf("no node could hash the data: %s", strings.Join(errs, "; "))
+	})
 	if err != nil {
 		return "", err
 	}
-	defer r.Close()
-	b, err := io.ReadAll(r)
+	return hash, nil
+}
+
+// GetFile reads a CID from the first healthy node or gateway that has it.
+func GetFile(hash string) (string, error) {
+	if Manager == nil {
+		log.Fatal("IPFS Manager is not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Manager.config.ReadDeadline)
+	defer cancel()
+
+	var data string
+	err := Manager.retryContext(ctx, "cat "+hash, func() error {
+		var errs []string
+		for _, s := range Manager.readOrder() {
+			if ctx.Err() != nil {
+				errs = append(errs, ctx.Err().Error())
+				break
+			}
+			d, err := s.Cat(ctx, hash)
+			if err != nil {
+				// a source that is up but doesn't have the content stays healthy
+				if ctx.Err() == nil && unavailable(err) {
+					s.SetHealthy(false)
+				}
+				errs = append(errs, fmt.Sprintf("%s: %v", s.URL(), err))
+				continue
+			}
+			data = d
+			return nil
+		}
+		return fmt.Errorf("no source returned %s: %s", hash, strings.Join(errs, "; "))
+	})
 	if err != nil {
 		return "", err
 	}
-	return string(b), nil
+	return data, nil
 }
 
+// PinFile pins a CID on every healthy primary node.
 func PinFile(hash string) error {
 	if Manager == nil {
 		log.Fatal("IPFS Manager is not initialized")
 	}
-	err := Manager.Shell.Pin(hash)
-	if err != nil {
-		return err
-	}
-	return nil
+	return Manager.retry("pin "+hash, func() error {
+		return eachWriteNode(func(n *Node) error { return n.Shell.Pin(hash) })
+	})
 }
 
+// UnpinFile unpins a CID on every healthy primary node.
 func UnpinFile(hash string) error {
 	if Manager == nil {
 		log.Fatal("IPFS Manager is not initialized")
 	}
-	err := Manager.Shell.Unpin(hash)
-	if err != nil {
-		return err
+	return Manager.retry("unpin "+hash, func() error {
+		return eachWriteNode(func(n *Node) error { return n.Shell.Unpin(hash) })
+	})
+}
+
+// eachWriteNode runs fn on every write node and succeeds if at least one node did.
+func eachWriteNode(fn func(n *Node) error) error {
+	var errs []string
+	ok := false
+	for _, n := range Manager.writeNodes() {
+		if err := fn(n); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", n.URL(), err))
+			continue
+		}
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("no node succeeded: %s", strings.Join(errs, "; "))
 	}
 	return nil
 }
 
+func pins() (map[string]shell.PinInfo, error) {
+	var pinned map[string]shell.PinInfo
+	err := Manager.retry("pin ls", func() error {
+		var err error
+		for _, n := range Manager.writeNodes() {
+			if pinned, err = n.Shell.Pins(); err == nil {
+				return nil
+			}
+			n.SetHealthy(false)
+		}
+		return err
+	})
+	return pinned, err
+}
+
 func GetPinList() {
-	pinnedFiles, err := Manager.Shell.Pins()
+	pinnedFiles, err := pins()
 	if err != nil {
 		log.Fatalf("Error getting pin list: %v", err)
 	}
@@ -100,7 +222,7 @@ func GetPinList() {
 }
 
 func IsPinned(hash string) bool {
-	pinnedFiles, err := Manager.Shell.Pins()
+	pinnedFiles, err := pins()
 	if err != nil {
 		log.Fatalf("Error getting pin list: %v", err)
 	}
@@ -0,0 +1,354 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// emptyCID is the inline CID of an empty block. Every gateway can serve it
+// without touching the network, which makes it a cheap liveness probe.
+const emptyCID = "bafkqaaa"
+
+// Config describes the IPFS sources used by the Manager.
+type Config struct {
+	APIURLs        []string      // IPFS HTTP API endpoints (primary nodes), in failover order
+	GatewayURLs    []string      // read-only HTTP gateways, tried after the API nodes
+	Timeout        time.Duration // per-call timeout
+	ReadDeadline   time.Duration // overall limit for a read, across every retry and source
+	Retries        int           // attempts per operation
+	Backoff        time.Duration // delay before the first retry, doubled after each attempt
+	HealthInterval time.Duration // how often sources are health checked
+}
+
+// DefaultConfig returns a Config for a single local node.
+func DefaultConfig() Config {
+	return Config{
+		APIURLs:        []string{"http://localhost:5001"},
+		Timeout:        10 * time.Second,
+		ReadDeadline:   30 * time.Second,
+		Retries:        3,
+		Backoff:        250 * time.Millisecond,
+		HealthInterval: 30 * time.Second,
+	}
+}
+
+// ConfigFromEnv builds a Config from IPFS_URL, IPFS_GATEWAYS, IPFS_TIMEOUT, IPFS_READ_DEADLINE,
+// IPFS_RETRIES, IPFS_BACKOFF and IPFS_HEALTH_INTERVAL. URL lists are comma separated.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	if urls := splitList(os.Getenv("IPFS_URL")); len(urls) > 0 {
+		config.APIURLs = urls
+	}
+	config.GatewayURLs = splitList(os.Getenv("IPFS_GATEWAYS"))
+
+	if d, err := time.ParseDuration(os.Getenv("IPFS_TIMEOUT")); err == nil && d > 0 {
+		config.Timeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("IPFS_READ_DEADLINE")); err == nil && d > 0 {
+		config.ReadDeadline = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("IPFS_RETRIES")); err == nil && n > 0 {
+		config.Retries = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("IPFS_BACKOFF")); err == nil && d >= 0 {
+		config.Backoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("IPFS_HEALTH_INTERVAL")); err == nil && d > 0 {
+		config.HealthInterval = d
+	}
+	return config
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// source is anything content can be read from.
+type source interface {
+	URL() string
+	Healthy() bool
+	SetHealthy(healthy bool)
+	Check() bool
+	Cat(ctx context.Context, hash string) (string, error)
+}
+
+// statusError is a source answering a request with an error status
+type statusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.url, e.status)
+}
+
+// unavailable reports whether a failed read means the source is down: a transport error or a 5xx.
+// A source answering that it doesn't have the content, or returning content that fails
+// verification, is still up.
+func unavailable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500
+	}
+	var shellErr *shell.Error
+	var verifyErr *verifyError
+	return !errors.As(err, &shellErr) && !errors.As(err, &verifyErr)
+}
+
+// verifyError is content that doesn't match the CID it was requested as
+type verifyError struct {
+	err error
+}
+
+func (e *verifyError) Error() string { return e.err.Error() }
+
+func (e *verifyError) Unwrap() error { return e.err }
+
+type health struct {
+	url     string
+	healthy atomic.Bool
+}
+
+func (h *health) URL() string { return h.url }
+
+func (h *health) Healthy() bool { return h.healthy.Load() }
+
+func (h *health) SetHealthy(healthy bool) {
+	if h.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Println("IPFS source is healthy again:", h.url)
+		} else {
+			log.Println("IPFS source marked unhealthy:", h.url)
+		}
+	}
+}
+
+// Node is an IPFS HTTP API endpoint. Nodes accept both reads and writes.
+type Node struct {
+	health
+	Shell *shell.Shell
+}
+
+func newNode(url string, timeout time.Duration) *Node {
+	n := &Node{Shell: shell.NewShellWithClient(url, &http.Client{Timeout: timeout})}
+	n.url = url
+	n.healthy.Store(true)
+	return n
+}
+
+func (n *Node) Check() bool {
+	return n.Shell.IsUp()
+}
+
+func (n *Node) Cat(ctx context.Context, hash string) (string, error) {
+	resp, err := n.Shell.Request("cat", hash).Send(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+	b, err := io.ReadAll(resp.Output)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Gateway is a read-only HTTP gateway serving /ipfs/<cid>.
+type Gateway struct {
+	health
+	client *http.Client
+}
+
+func newGateway(url string, timeout time.Duration) *Gateway {
+	g := &Gateway{client: &http.Client{Timeout: timeout}}
+	g.url = strings.TrimSuffix(url, "/")
+	g.healthy.Store(true)
+	return g
+}
+
+func (g *Gateway) Check() bool {
+	resp, err := g.client.Get(g.url + "/ipfs/" + emptyCID)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Cat reads a file as trustless raw blocks, verifying every block against its CID, so a
+// gateway can't serve anything but the requested content.
+func (g *Gateway) Cat(ctx context.Context, hash string) (string, error) {
+	root, err := cid.Decode(hash)
+	if err != nil {
+		return "", &verifyError{fmt.Errorf("invalid CID %s: %w", hash, err)}
+	}
+	var buf bytes.Buffer
+	if err := g.catBlock(ctx, root, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// catBlock appends the file content under c to buf, depth first
+func (g *Gateway) catBlock(ctx context.Context, c cid.Cid, buf *bytes.Buffer) error {
+	block, err := g.block(ctx, c)
+	if err != nil {
+		return err
+	}
+	data, links, err := fileBlock(c, block)
+	if err != nil {
+		return &verifyError{err}
+	}
+	if buf.Len()+len(data) > maxGatewayFileSize {
+		return &verifyError{fmt.Errorf("file is larger than %d bytes", maxGatewayFileSize)}
+	}
+	buf.Write(data)
+	for _, link := range links {
+		if err := g.catBlock(ctx, link, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// block fetches a single verified block
+func (g *Gateway) block(ctx context.Context, c cid.Cid) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", g.url+"/ipfs/"+c.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: g.url, status: resp.Status, code: resp.StatusCode}
+	}
+	block, err := io.ReadAll(io.LimitReader(resp.Body, maxGatewayFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlock(c, block); err != nil {
+		return nil, &verifyError{fmt.Errorf("gateway %s: %w", g.url, err)}
+	}
+	return block, nil
+}
+
+// CheckHealth probes every node and gateway once and records the result.
+func (m *IPFSManager) CheckHealth() {
+	for _, s := range m.sources() {
+		s.SetHealthy(s.Check())
+	}
+}
+
+// StartHealthChecks probes all sources every HealthInterval until StopHealthChecks is called.
+func (m *IPFSManager) StartHealthChecks() {
+	ticker := time.NewTicker(m.config.HealthInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.CheckHealth()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthChecks stops the background health checks.
+func (m *IPFSManager) StopHealthChecks() {
+	close(m.stop)
+}
+
+func (m *IPFSManager) sources() []source {
+	sources := make([]source, 0, len(m.nodes)+len(m.gateways))
+	for _, n := range m.nodes {
+		sources = append(sources, n)
+	}
+	for _, g := range m.gateways {
+		sources = append(sources, g)
+	}
+	return sources
+}
+
+// readOrder returns healthy sources first (nodes before gateways, in configured
+// order), followed by unhealthy ones as a last resort.
+func (m *IPFSManager) readOrder() []source {
+	var healthy, unhealthy []source
+	for _, s := range m.sources() {
+		if s.Healthy() {
+			healthy = append(healthy, s)
+		} else {
+			unhealthy = append(unhealthy, s)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// writeNodes returns the healthy primary nodes, or all of them if none are healthy.
+func (m *IPFSManager) writeNodes() []*Node {
+	var healthy []*Node
+	for _, n := range m.nodes {
+		if n.Healthy() {
+			healthy = append(healthy, n)
+		}
+	}
+	if len(healthy) == 0 {
+		return m.nodes
+	}
+	return healthy
+}
+
+// retry runs fn up to config.Retries times with exponential backoff.
+func (m *IPFSManager) retry(op string, fn func() error) error {
+	return m.retryContext(context.Background(), op, fn)
+}
+
+// retryContext is retry that gives up once ctx is done.
+func (m *IPFSManager) retryContext(ctx context.Context, op string, fn func() error) error {
+	backoff := m.config.Backoff
+	var err error
+	for attempt := 1; attempt <= m.config.Retries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		log.Printf("IPFS %s failed (attempt %d/%d): %v", op, attempt, m.config.Retries, err)
+		if attempt < m.config.Retries {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+			}
+			backoff *= 2
+		}
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// fakeNode is an IPFS HTTP API serving cat from files
+func fakeNode(t *testing.T, files map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/version":
+			w.Write([]byte(`{"Version": "0.0.0-test"}`))
+		case "/api/v0/cat":
+			data, ok := files[r.URL.Query().Get("arg")]
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"Message": "block not found", "Code": 0, "Type": "error"}`))
+				return
+			}
+			w.Write([]byte(data))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fakeGateway is a trustless gateway serving raw blocks by CID
+func fakeGateway(t *testing.T, blocks map[string][]byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := strings.TrimPrefix(r.URL.Path, "/ipfs/")
+		if c == emptyCID {
+			return
+		}
+		block, ok := blocks[c]
+		if !ok || r.URL.Query().Get("format") != "raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(block)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// chunkedFile builds "abcdef" as a UnixFS file split over raw leaves and a nested dag-pb node,
+// returning its root CID and every block by CID
+func chunkedFile(t *testing.T) (cid.Cid, map[string][]byte) {
+	blocks := make(map[string][]byte)
+	add := func(prefix cid.Prefix, block []byte) cid.Cid {
+		c := sum(t, prefix, block)
+		blocks[c.String()] = block
+		return c
+	}
+	ab := add(rawPrefix, []byte("ab"))
+	cd := add(rawPrefix, []byte("cd"))
+	nested := add(dagPBPrefix, pbNode(unixfsNode(unixfsFile, ""), cd))
+	ef := add(rawPrefix, []byte("ef"))
+	root := add(dagPBPrefix, pbNode(unixfsNode(unixfsFile, ""), ab, nested, ef))
+	return root, blocks
+}
+
+func TestGatewayCat(t *testing.T) {
+	root, blocks := chunkedFile(t)
+	leaf := sum(t, rawPrefix, []byte("cd"))
+
+	forged := make(map[string][]byte)
+	for c, block := range blocks {
+		forged[c] = block
+	}
+	forged[leaf.String()] = []byte("XX")
+
+	missing := make(map[string][]byte)
+	for c, block := range blocks {
+		if c != leaf.String() {
+			missing[c] = block
+		}
+	}
+
+	tests := []struct {
+		name       string
+		blocks     map[string][]byte
+		want       string
+		wantVerify bool // the error is content failing verification, not the gateway being down
+	}{
+		{name: "multi-link file", blocks: blocks, want: "abcdef"},
+		{name: "forged leaf", blocks: forged, wantVerify: true},
+		{name: "missing leaf", blocks: missing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := newGateway(fakeGateway(t, tt.blocks).URL, time.Second)
+			data, err := gateway.Cat(context.Background(), root.String())
+			if tt.want != "" {
+				if err != nil || data != tt.want {
+					t.Fatalf("Cat = %q, %v, want %q", data, err, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Cat = %q, want an error", data)
+			}
+			var verifyErr *verifyError
+			if isVerify := errors.As(err, &verifyErr); isVerify != tt.wantVerify {
+				t.Fatalf("err = %v, verification failure: %v, want %v", err, isVerify, tt.wantVerify)
+			}
+			if unavailable(err) {
+				t.Fatalf("%v marks a gateway that answered as down", err)
+			}
+		})
+	}
+}
+
+// useManager replaces the global Manager for the rest of the test
+func useManager(t *testing.T, config Config) *IPFSManager {
+	t.Helper()
+	previous := Manager
+	config.Timeout, config.ReadDeadline, config.HealthInterval = time.Second, 5*time.Second, time.Hour
+	if err := InitManager(config); err != nil {
+		t.Fatal(err)
+	}
+	m := Manager
+	t.Cleanup(func() {
+		m.StopHealthChecks()
+		Manager = previous
+	})
+	return m
+}
+
+func TestGetFileFailover(t *testing.T) {
+	root, blocks := chunkedFile(t)
+	hash := root.String()
+
+	tests := []struct {
+		name string
+		// sources is called with a node that goes down after the manager's first health check
+		sources     func(dead string) Config
+		want        string
+		wantHealthy []bool // nodes, then gateways
+	}{
+		{
+			name: "healthy node after a dead one",
+			sources: func(dead string) Config {
+				return Config{APIURLs: []string{dead, fakeNode(t, map[string]string{hash: "abcdef"}).URL}}
+			},
+			want:        "abcdef",
+			wantHealthy: []bool{false, true},
+		},
+		{
+			name: "gateway after a dead node",
+			sources: func(dead string) Config {
+				return Config{APIURLs: []string{dead}, GatewayURLs: []string{fakeGateway(t, blocks).URL}}
+			},
+			want:        "abcdef",
+			wantHealthy: []bool{false, true},
+		},
+		{
+			name: "node without the content stays healthy",
+			sources: func(dead string) Config {
+				return Config{APIURLs: []string{fakeNode(t, nil).URL, dead}, GatewayURLs: []string{fakeGateway(t, blocks).URL}}
+			},
+			want:        "abcdef",
+			wantHealthy: []bool{true, false, true},
+		},
+		{
+			name: "every source down",
+			sources: func(dead string) Config {
+				return Config{APIURLs: []string{dead}}
+			},
+			wantHealthy: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dead := fakeNode(t, map[string]string{hash: "abcdef"})
+			config := tt.sources(dead.URL)
+			config.Retries = 2
+			m := useManager(t, config)
+			dead.Close()
+
+			data, err := GetFile(hash)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("GetFile = %q, want an error", data)
+				}
+			} else if err != nil || data != tt.want {
+				t.Fatalf("GetFile = %q, %v, want %q", data, err, tt.want)
+			}
+			for i, s := range m.sources() {
+				if s.Healthy() != tt.wantHealthy[i] {
+					t.Errorf("%s healthy = %v, want %v", s.URL(), s.Healthy(), tt.wantHealthy[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	m := &IPFSManager{config: Config{Retries: 3, Backoff: 10 * time.Millisecond}}
+	attempts := 0
+	start := time.Now()
+	err := m.retry("test", func() error {
+		if attempts++; attempts < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("retry = %v after %d attempts, want success on the third", err, attempts)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("retried after %s, want the backoff doubled between attempts (10ms + 20ms)", elapsed)
+	}
+}
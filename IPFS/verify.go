@@ -0,0 +1,146 @@
+package ipfs
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// largest file read through a gateway, in bytes
+const maxGatewayFileSize = 32 << 20
+
+// UnixFS node types that carry file content
+const (
+	unixfsRaw  = 0
+	unixfsFile = 2
+)
+
+// verifyBlock checks that a block's bytes hash to its CID
+func verifyBlock(c cid.Cid, block []byte) error {
+	sum, err := c.Prefix().Sum(block)
+	if err != nil {
+		return fmt.Errorf("failed to hash block %s: %w", c, err)
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("block does not match %s", c)
+	}
+	return nil
+}
+
+// fileBlock returns the content stored in a verified block and the CIDs of the blocks holding
+// the rest of the file, in order. Raw blocks are all content; dag-pb blocks are UnixFS files.
+func fileBlock(c cid.Cid, block []byte) ([]byte, []cid.Cid, error) {
+	switch c.Type() {
+	case cid.Raw:
+		return block, nil, nil
+	case cid.DagProtobuf:
+		pbData, links, err := decodePBNode(block)
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %s: %w", c, err)
+		}
+		data, err := unixfsFileData(pbData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %s: %w", c, err)
+		}
+		return data, links, nil
+	default:
+		return nil, nil, fmt.Errorf("block %s: unsupported codec %d", c, c.Type())
+	}
+}
+
+// decodePBNode decodes a dag-pb node: its Data field (1) and the hashes of its Links (2)
+func decodePBNode(b []byte) ([]byte, []cid.Cid, error) {
+	var data []byte
+	var links []cid.Cid
+	err := eachField(b, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			data = value
+		case 2:
+			var hash []byte
+			if err := eachField(value, func(num protowire.Number, value []byte) error {
+				if num == 1 {
+					hash = value
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			link, err := cid.Cast(hash)
+			if err != nil {
+				return fmt.Errorf("invalid link: %w", err)
+			}
+			links = append(links, link)
+		}
+		return nil
+	})
+	return data, links, err
+}
+
+// unixfsFileData returns the content of a UnixFS file or raw node: its Data field (2)
+func unixfsFileData(b []byte) ([]byte, error) {
+	nodeType := -1
+	var data []byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			nodeType = int(v)
+			b = b[n:]
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = v
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	if nodeType != unixfsFile && nodeType != unixfsRaw {
+		return nil, fmt.Errorf("not a file (unixfs type %d)", nodeType)
+	}
+	return data, nil
+}
+
+// eachField calls fn with every length delimited field of a protobuf message, skipping others
+func eachField(b []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
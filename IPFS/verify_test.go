@@ -0,0 +1,109 @@
+package ipfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	rawPrefix     = cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}
+	dagPBPrefix   = cid.Prefix{Version: 1, Codec: cid.DagProtobuf, MhType: multihash.SHA2_256, MhLength: -1}
+	dagCBORPrefix = cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: multihash.SHA2_256, MhLength: -1}
+)
+
+// sum returns the CID of block
+func sum(t *testing.T, prefix cid.Prefix, block []byte) cid.Cid {
+	t.Helper()
+	c, err := prefix.Sum(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// unixfsNode encodes a UnixFS node of nodeType holding data
+func unixfsNode(nodeType uint64, data string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, nodeType)
+	if data != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, data)
+	}
+	return b
+}
+
+// pbNode encodes a dag-pb node, links first as in the canonical encoding
+func pbNode(data []byte, links ...cid.Cid) []byte {
+	var b []byte
+	for _, link := range links {
+		var pbLink []byte
+		pbLink = protowire.AppendTag(pbLink, 1, protowire.BytesType)
+		pbLink = protowire.AppendBytes(pbLink, link.Bytes())
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, pbLink)
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, data)
+}
+
+func TestFileBlock(t *testing.T) {
+	leaf := []byte("hello")
+	leafCID := sum(t, rawPrefix, leaf)
+	other := sum(t, rawPrefix, []byte("world"))
+	fileNode := pbNode(unixfsNode(unixfsFile, "inline"))
+	multiLink := pbNode(unixfsNode(unixfsFile, ""), leafCID, other)
+	directory := pbNode(unixfsNode(1, ""), leafCID)
+
+	tests := []struct {
+		name      string
+		cid       cid.Cid
+		block     []byte
+		wantData  string
+		wantLinks []cid.Cid
+		wantErr   string
+	}{
+		{name: "raw block", cid: leafCID, block: leaf, wantData: "hello"},
+		{name: "unixfs file", cid: sum(t, dagPBPrefix, fileNode), block: fileNode, wantData: "inline"},
+		{name: "multi-link file", cid: sum(t, dagPBPrefix, multiLink), block: multiLink, wantLinks: []cid.Cid{leafCID, other}},
+		{name: "tampered block", cid: leafCID, block: []byte("hellO"), wantErr: "does not match"},
+		{name: "block of another CID", cid: other, block: leaf, wantErr: "does not match"},
+		{name: "raw bytes under a dag-pb CID", cid: sum(t, dagPBPrefix, leaf), block: leaf, wantErr: "block"},
+		{name: "unsupported codec", cid: sum(t, dagCBORPrefix, leaf), block: leaf, wantErr: "unsupported codec"},
+		{name: "directory", cid: sum(t, dagPBPrefix, directory), block: directory, wantErr: "not a file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyBlock(tt.cid, tt.block)
+			var data []byte
+			var links []cid.Cid
+			if err == nil {
+				data, links, err = fileBlock(tt.cid, tt.block)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+			if len(links) != len(tt.wantLinks) {
+				t.Fatalf("links = %v, want %v", links, tt.wantLinks)
+			}
+			for i := range links {
+				if !links[i].Equals(tt.wantLinks[i]) {
+					t.Errorf("link %d = %s, want %s", i, links[i], tt.wantLinks[i])
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	_ "dreamfriday/utils"
 
@@ -14,6 +16,7 @@ import (
 
 var store *sessions.CookieStore
 var restrict_to_address string
+var admin_addresses map[string]bool
 
 // Authenticator interface for multiple authentication providers
 type Authenticator interface {
@@ -38,10 +41,30 @@ func InitSessionStore() {
 
 	log.Println("setting restrict_to_address", restrict_to_address)
 
+	admin_addresses = make(map[string]bool)
+	for _, address := range strings.Split(os.Getenv("ADMIN_ADDRESSES"), ",") {
+		if address = strings.ToLower(strings.TrimSpace(address)); address != "" {
+			admin_addresses[address] = true
+		}
+	}
+
 	if hashKey == "" || blockKey == "" {
 		log.Fatal("Error: SESSION_HASH_KEY or SESSION_BLOCK_KEY is not set")
 	}
 
+	// challenges must verify on every instance, so fall back to the shared session key
+	challengeSigningKey = []byte(os.Getenv("CHALLENGE_SIGNING_KEY"))
+	if len(challengeSigningKey) == 0 {
+		challengeSigningKey = []byte(hashKey)
+	}
+	if chainID := os.Getenv("SIWE_CHAIN_ID"); chainID != "" {
+		id, err := strconv.ParseInt(chainID, 10, 64)
+		if err != nil {
+			log.Fatalf("Error: invalid SIWE_CHAIN_ID %q", chainID)
+		}
+		siweChainID = id
+	}
+
 	// // if ENV=development, set allowDomain to localhost, otherwise set to utils.BaseDomain
 
 	store = sessions.NewCookieStore([]byte(hashKey), []byte(blockKey))
@@ -52,25 +75,54 @@ func InitSessionStore() {
 		Secure:   useHTTPS,
 		SameSite: http.SameSiteLaxMode,
 	}
+	sessionMaxIdle = sessionCookieMaxAge(store.Options)
 
 }
 
-// GetSession retrieves the user's session
+// GetSession retrieves the user's session. A session whose server-side record was
+// revoked or expired comes back logged out.
 func GetSession(r *http.Request) (*sessions.Session, error) {
 	if store == nil {
 		log.Println("Session store is not initialized! Ensure InitSessionStore() is called before using sessions.")
 		return nil, fmt.Errorf("session store is not initialized")
 	}
-	return store.Get(r, "session")
+	session, err := store.Get(r, "session")
+	if err != nil {
+		return session, err
+	}
+	verifySession(session)
+	return session, nil
 }
 
+// Session returns the request's verified session. It is looked up once per request and kept on
+// the echo context, so checking it again doesn't reach Bolt.
+func Session(c echo.Context) (*sessions.Session, error) {
+	if session, ok := c.Get(sessionContextKey).(*sessions.Session); ok {
+		return session, nil
+	}
+	session, err := GetSession(c.Request())
+	if err != nil {
+		return session, err
+	}
+	c.Set(sessionContextKey, session)
+	return session, nil
+}
+
+// echo context key of the request's verified session
+const sessionContextKey = "session"
+
 // Export function to allow other auth files to use the session store
 func GetSessionStore() *sessions.CookieStore {
 	return store
 }
 
+// GetHandle returns the handle of the logged in user, or of the API token's owner
 func GetHandle(c echo.Context) (string, error) {
-	session, err := GetSession(c.Request())
+	if handle, ok := c.Get("handle").(string); ok && handle != "" {
+		return handle, nil
+	}
+
+	session, err := Session(c)
 	if err != nil {
 		return "", fmt.Errorf("failed to get session: %v", err)
 	}
@@ -83,46 +135,64 @@ func GetHandle(c echo.Context) (string, error) {
 	return handle, nil
 }
 
+// IsAuthenticated reports whether the request has a live session. Session already checked it
+// against the server-side session, which it drops the handle for when revoked or expired.
 func IsAuthenticated(c echo.Context) bool {
 
-	session, err := store.Get(c.Request(), "session")
+	session, err := Session(c)
 	if err != nil {
 		log.Println("Failed to retrieve session:", err)
 		return false
 	}
 
-	// Get authenticator
-	authenticator := GetAuthenticator()
-
-	// Retrieve session token
-	token, ok := session.Values["handle"].(string)
-	if !ok || token == "" {
+	if handle, ok := session.Values["handle"].(string); !ok || handle == "" {
 		log.Println("handle not set in session")
 		return false
 	}
 
-	// Validate session token
-	if !authenticator.ValidateSession(token) {
-		log.Println("Session validation failed")
-		return false
-	}
-
 	return true
 
 }
 
-// Middleware version of IsAuthenticated for Echo
+// Middleware version of IsAuthenticated for Echo. Browsers are sent to /login,
+// API calls get a JSON 401.
 func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if !IsAuthenticated(c) {
+			if wantsJSON(c) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			}
 			return c.Redirect(http.StatusFound, "/login")
 		}
 		return next(c)
 	}
 }
 
-// Factory function to get the correct authenticator
+// IsAdmin reports whether a handle is listed in ADMIN_ADDRESSES
+func IsAdmin(handle string) bool {
+	return admin_addresses[strings.ToLower(handle)]
+}
+
+// AdminMiddleware only allows handles listed in ADMIN_ADDRESSES. Use after AuthMiddleware.
+func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		handle, err := GetHandle(c)
+		if err != nil || !IsAdmin(handle) {
+			log.Printf("Forbidden: %s is not an admin", handle)
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Forbidden"})
+		}
+		return next(c)
+	}
+}
+
+// Factory function to get the default authenticator
 func GetAuthenticator() Authenticator {
 	// return &Auth0Authenticator{}
+	if authenticator, ok := GetProvider("eth"); ok {
+		return authenticator
+	}
+	if len(providerNames) > 0 {
+		return providers[providerNames[0]]
+	}
 	return &EthAuthenticator{}
 }
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	database "dreamfriday/database"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "auth-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := database.BoltInit(filepath.Join(dir, "test.db")); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("SESSION_HASH_KEY", "0123456789abcdef0123456789abcdef")
+	os.Setenv("SESSION_BLOCK_KEY", "fedcba9876543210fedcba9876543210")
+	InitSessionStore()
+	log.SetOutput(io.Discard)
+	RegisterProvider("eth", &EthAuthenticator{})
+	RegisterProvider("email", &EmailAuthenticator{})
+	RegisterProvider("oidc", &OIDCAuthenticator{})
+	RegisterProvider("webauthn", &WebAuthnAuthenticator{})
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// browser carries cookies between requests, like the browser a login flow runs in
+type browser struct {
+	echo    *echo.Echo
+	cookies []*http.Cookie
+}
+
+func newBrowser() *browser {
+	return &browser{echo: echo.New()}
+}
+
+// request builds an echo context for a request sent with the browser's cookies. Call done
+// after the handler ran to keep the cookies it set.
+func (b *browser) request(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	return b.echo.NewContext(req, rec), rec
+}
+
+func (b *browser) done(rec *httptest.ResponseRecorder) {
+	for _, cookie := range rec.Result().Cookies() {
+		kept := b.cookies[:0]
+		for _, existing := range b.cookies {
+			if existing.Name != cookie.Name {
+				kept = append(kept, existing)
+			}
+		}
+		b.cookies = append(kept, cookie)
+	}
+}
+
+// handle returns who the browser is logged in as, or "" if nobody
+func (b *browser) handle() string {
+	c, _ := b.request(http.MethodGet, "/", "")
+	handle, err := GetHandle(c)
+	if err != nil {
+		return ""
+	}
+	return handle
+}
+
+// restrictLogin sets RESTRICT_LOGIN_TO_ADDRESS for the rest of the test
+func restrictLogin(t *testing.T, address string) {
+	previous := restrict_to_address
+	restrict_to_address = address
+	t.Cleanup(func() { restrict_to_address = previous })
+}
+
+// enableOnly leaves only the named providers enabled for the rest of the test
+func enableOnly(t *testing.T, names ...string) {
+	previous, previousNames := providers, providerNames
+	providers, providerNames = make(map[string]Authenticator), nil
+	for _, name := range names {
+		providers[name], providerNames = previous[name], append(providerNames, name)
+	}
+	t.Cleanup(func() { providers, providerNames = previous, previousNames })
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	models "dreamfriday/models"
+	utils "dreamfriday/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AccessError is why a request may not act on a site, with the status to answer with
+type AccessError struct {
+	Status  int
+	Message string
+}
+
+func (e *AccessError) Error() string {
+	return e.Message
+}
+
+// AccessDenied answers a request AuthorizeSite refused, with the AccessError's status.
+// Any other error is a failure to check access, not a refusal.
+func AccessDenied(c echo.Context, err error) error {
+	var accessErr *AccessError
+	if !errors.As(err, &accessErr) {
+		log.Println("Failed to authorize site access:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	return c.JSON(accessErr.Status, map[string]string{"error": accessErr.Message})
+}
+
+// AuthorizeSite is the single place site permissions are checked: it loads the
+// request's site and makes sure the logged in user (or token owner) may perform action on it
+func AuthorizeSite(c echo.Context, action string) (*models.Site, string, error) {
+	return AuthorizeSiteNamed(c, utils.GetSubdomain(c.Request().Host), action)
+}
+
+// AuthorizeSiteNamed is AuthorizeSite for a site other than the request's host.
+// Deleted sites can only be managed (restored), nothing else.
+func AuthorizeSiteNamed(c echo.Context, siteName, action string) (*models.Site, string, error) {
+	handle, err := GetHandle(c)
+	if err != nil || handle == "" {
+		return nil, "", &AccessError{Status: http.StatusUnauthorized, Message: "Unauthorized"}
+	}
+	site, err := models.GetSite(siteName)
+	if err != nil || (site.Status == models.SiteStatusDeleted && action != models.ActionManageSite) {
+		return nil, handle, &AccessError{Status: http.StatusNotFound, Message: "Site not found"}
+	}
+	if !site.Can(handle, action) {
+		log.Printf("Forbidden: %s (%s) may not %s on %s", handle, site.RoleOf(handle), action, siteName)
+		return nil, handle, &AccessError{Status: http.StatusForbidden, Message: "Forbidden: you may not " + action + " on this site"}
+	}
+	return site, handle, nil
+}
+
+// RequireSiteAccess only lets requests through that may perform action on the request's site.
+// Use after AuthMiddleware or RequireScope. The site is available as c.Get("site").
+func RequireSiteAccess(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			site, _, err := AuthorizeSite(c, action)
+			if err != nil {
+				return AccessDenied(c, err)
+			}
+			c.Set("site", site)
+			return next(c)
+		}
+	}
+}
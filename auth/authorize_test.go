@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAccessDenied(t *testing.T) {
+	forbidden := &AccessError{Status: http.StatusForbidden, Message: "Forbidden"}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "access error", err: forbidden, wantStatus: http.StatusForbidden, wantBody: `{"error":"Forbidden"}`},
+		{name: "wrapped access error", err: fmt.Errorf("publish: %w", forbidden), wantStatus: http.StatusForbidden, wantBody: `{"error":"Forbidden"}`},
+		{name: "other error", err: errors.New("database not initialized"), wantStatus: http.StatusInternalServerError, wantBody: `{"error":"Internal server error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newBrowser().request(http.MethodGet, "/", "")
+			if err := AccessDenied(c, tt.err); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus || rec.Body.String() != tt.wantBody+"\n" {
+				t.Fatalf("answered %d %s, want %d %s", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Signature formats accepted on /auth/callback
+const (
+	FormatPersonalSign = "personal_sign" // EIP-191 signature over the SIWE message text (default)
+	FormatTypedData    = "eip712"        // EIP-712 signature over LoginTypedData
+)
+
+// LoginTypedData carries the same fields as a SIWE message as EIP-712 typed data,
+// for wallets (and multisigs) that prefer eth_signTypedData_v4
+func LoginTypedData(m *SiweMessage) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"Login": {
+				{Name: "domain", Type: "string"},
+				{Name: "address", Type: "address"},
+				{Name: "statement", Type: "string"},
+				{Name: "uri", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "nonce", Type: "string"},
+				{Name: "issuedAt", Type: "string"},
+				{Name: "expirationTime", Type: "string"},
+			},
+		},
+		PrimaryType: "Login",
+		Domain: apitypes.TypedDataDomain{
+			Name:    "dreamfriday",
+			Version: "1",
+			ChainId: (*math.HexOrDecimal256)(big.NewInt(m.ChainID)),
+		},
+		Message: apitypes.TypedDataMessage{
+			"domain":         m.Domain,
+			"address":        m.Address,
+			"statement":      m.Statement,
+			"uri":            m.URI,
+			"version":        m.Version,
+			"chainId":        (*math.HexOrDecimal256)(big.NewInt(m.ChainID)),
+			"nonce":          m.Nonce,
+			"issuedAt":       m.IssuedAt.UTC().Format(time.RFC3339),
+			"expirationTime": m.ExpirationTime.UTC().Format(time.RFC3339),
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"dreamfriday/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EmailConfig configures the SMTP server magic links are sent through
+type EmailConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	BaseURL  string // origin of every magic link; never taken from the request, whose Host header the client controls
+}
+
+// EmailConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM and EMAIL_LINK_BASE_URL
+func EmailConfigFromEnv() EmailConfig {
+	config := EmailConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		BaseURL:  os.Getenv("EMAIL_LINK_BASE_URL"),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.From == "" {
+		config.From = "login@" + utils.BaseDomain
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "https://" + utils.BaseDomain
+	}
+	return config
+}
+
+// EmailAuthenticator logs users in with single-use links sent by email
+type EmailAuthenticator struct {
+	config EmailConfig
+}
+
+const magicLinkExpiry = 15 * time.Minute
+
+func NewEmailAuthenticator(config EmailConfig) *EmailAuthenticator {
+	return &EmailAuthenticator{config: config}
+}
+
+// Login emails a magic link for address (to match interface)
+func (a *EmailAuthenticator) Login(c echo.Context, address, _ string) error {
+	if err := a.sendLink(a.config.BaseURL, address); err != nil {
+		log.Println("Failed to send login link:", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// Register emails a magic link; the account is created when it is first used
+func (a *EmailAuthenticator) Register(address, _ string) error {
+	return a.sendLink(a.config.BaseURL, address)
+}
+
+// PasswordReset has no password to reset, so it sends a fresh login link
+func (a *EmailAuthenticator) PasswordReset(address string) error {
+	return a.sendLink(a.config.BaseURL, address)
+}
+
+func (a *EmailAuthenticator) sendLink(origin, address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return fmt.Errorf("invalid email address")
+	}
+	email := strings.ToLower(parsed.Address)
+
+	random := make([]byte, 32)
+	rand.Read(random)
+	token := hex.EncodeToString(random)
+	if err := issueNonce(token, email, time.Now().Add(magicLinkExpiry)); err != nil {
+		return fmt.Errorf("failed to create login link: %w", err)
+	}
+
+	link := origin + "/auth/email/callback?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("To: %s\r\nFrom: %s\r\nSubject: Your login link\r\n\r\n"+
+		"Use this link to log in. It expires in %d minutes and can only be used once.\r\n\r\n%s\r\n",
+		email, a.config.From, int(magicLinkExpiry.Minutes()), link)
+
+	var smtpAuth smtp.Auth
+	if a.config.Username != "" {
+		smtpAuth = smtp.PlainAuth("", a.config.Username, a.config.Password, a.config.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(a.config.Host, a.config.Port), smtpAuth, a.config.From, []string{email}, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	log.Println("Sent login link to", email)
+	return nil
+}
+
+// CallbackHandler logs in with the token from a magic link
+func (a *EmailAuthenticator) CallbackHandler(c echo.Context) error {
+	issued, err := takeNonce(c.QueryParam("token"))
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "This login link is invalid or has expired")
+	}
+
+	if _, err := completeLogin(c, "email", issued.Address, "email:"+issued.Address); err != nil {
+		log.Println("Error storing session:", err)
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+	return c.Redirect(http.StatusFound, "/admin")
+}
+
+// StoreSession stores the authenticated handle in a session
+func (a *EmailAuthenticator) StoreSession(c echo.Context, _, handle string) error {
+	return storeHandle(c, "email", handle)
+}
+
+// ValidateSession for email authentication
+func (a *EmailAuthenticator) ValidateSession(token string) bool {
+	return activeSession(token, "")
+}
+
+// Logout clears the session for email users
+func (a *EmailAuthenticator) Logout(c echo.Context) error {
+	return clearSession(c)
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a stand-in SMTP server that accepts every message and hands it to the test
+type fakeSMTP struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{listener: listener, messages: make(chan string, 10)}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(command, "MAIL FROM"), strings.HasPrefix(command, "RCPT TO"), command == "RSET", command == "NOOP":
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 go ahead")
+			var message strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				message.WriteString(line)
+			}
+			s.messages <- message.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// next returns the next message the server received
+func (s *fakeSMTP) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+		return ""
+	}
+}
+
+func (s *fakeSMTP) config() EmailConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return EmailConfig{Host: host, Port: port, From: "login@example.com", BaseURL: "https://login.example.com"}
+}
+
+// magicLink returns the login link in an email
+func magicLink(t *testing.T, message string) *url.URL {
+	t.Helper()
+	for _, line := range strings.Split(message, "\r\n") {
+		if strings.Contains(line, "/auth/email/callback?token=") {
+			link, err := url.Parse(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return link
+		}
+	}
+	t.Fatalf("no login link in %q", message)
+	return nil
+}
+
+func TestEmailMagicLink(t *testing.T) {
+	server := newFakeSMTP(t)
+	authenticator := NewEmailAuthenticator(server.config())
+
+	tests := []struct {
+		name       string
+		address    string
+		restrict   string
+		wantHandle string
+		wantStatus int
+	}{
+		{name: "logs in with the lowercased address", address: "Someone@Example.com", wantHandle: "email:someone@example.com", wantStatus: http.StatusFound},
+		{name: "display names are dropped", address: "Other Person <other@example.com>", wantHandle: "email:other@example.com", wantStatus: http.StatusFound},
+		{name: "restricted login refuses email accounts", address: "third@example.com", restrict: "0x00000000000000000000000000000000000000a1", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restrictLogin(t, tt.restrict)
+			b := newBrowser()
+
+			// the request's Host is attacker controlled, so it must not end up in the link
+			c, rec := b.request(http.MethodPost, "/login", "")
+			c.Request().Host = "evil.example"
+			if err := authenticator.Login(c, tt.address, ""); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("login: %v, status %d: %s", err, rec.Code, rec.Body)
+			}
+			link := magicLink(t, server.next(t))
+			if link.Scheme+"://"+link.Host != "https://login.example.com" {
+				t.Fatalf("link %s is not on the configured base url", link)
+			}
+
+			c, rec = b.request(http.MethodGet, link.RequestURI(), "")
+			authenticator.CallbackHandler(c)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			b.done(rec)
+			if got := b.handle(); got != tt.wantHandle {
+				t.Fatalf("logged in as %q, want %q", got, tt.wantHandle)
+			}
+
+			// links are single use
+			replay := newBrowser()
+			c, rec = replay.request(http.MethodGet, link.RequestURI(), "")
+			authenticator.CallbackHandler(c)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("reused link status = %d, want 401", rec.Code)
+			}
+		})
+	}
+}
+
+func TestEmailSendFailures(t *testing.T) {
+	server := newFakeSMTP(t)
+	down := server.config()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, down.Port, _ = net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	tests := []struct {
+		name    string
+		config  EmailConfig
+		address string
+	}{
+		{"invalid address", server.config(), "not an address"},
+		{"smtp server unreachable", down, "someone@example.com"},
+	}
+	for _, tt := range tests {
+		if err := NewEmailAuthenticator(tt.config).Register(tt.address, ""); err == nil {
+			t.Errorf("%s: sending a link succeeded", tt.name)
+		}
+	}
+	select {
+	case message := <-server.messages:
+		t.Fatalf("sent %q", message)
+	default:
+	}
+
+	c, rec := newBrowser().request(http.MethodGet, "/auth/email/callback?token=unknown", "")
+	NewEmailAuthenticator(server.config()).CallbackHandler(c)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown token status = %d, want 401", rec.Code)
+	}
+}
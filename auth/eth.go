@@ -1,10 +1,11 @@
 package auth
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,6 +22,9 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	ethereum "dreamfriday/ethereum"
 
 	"github.com/labstack/echo/v4"
 )
@@ -33,37 +37,69 @@ type AuthRequest struct {
 	Address   string `json:"address"`
 	Challenge string `json:"challenge"`
 	Signature string `json:"signature"`
+	Format    string `json:"format,omitempty"` // personal_sign (default) or eip712
 }
 
+// ChallengeResponse holds the SIWE message to sign, and the same challenge as EIP-712 typed data
 type ChallengeResponse struct {
-	Challenge string `json:"challenge"`
+	Challenge string             `json:"challenge"`
+	TypedData apitypes.TypedData `json:"typedData"`
 }
 
 var challengeSigningKey []byte
+var siweChainID int64 = 1
 
 const challengeExpiry = 5 * time.Minute
 
-// Generate a random nonce (challenge) for authentication
-func generateChallenge() string {
-	nonce := make([]byte, 32)
-	rand.Read(nonce)
-
-	expiry := time.Now().UTC().Add(challengeExpiry).Unix()
-
-	// create nonce:expiry challenge
-	challenge := fmt.Sprintf("%s:%d", base64.StdEncoding.EncodeToString(nonce), expiry)
+// Generate an EIP-4361 message (challenge) for address, bound to the domain the request came in on
+func generateChallenge(c echo.Context, address string) *SiweMessage {
+	random := make([]byte, 16)
+	rand.Read(random)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	domain := c.Request().Host
+
+	message := &SiweMessage{
+		Domain:         domain,
+		Address:        common.HexToAddress(address).Hex(),
+		Statement:      "Sign in to " + domain,
+		URI:            requestOrigin(c),
+		Version:        "1",
+		ChainID:        siweChainID,
+		IssuedAt:       now,
+		ExpirationTime: now.Add(challengeExpiry),
+	}
 
-	// sign
-	sig := signChallenge(challenge)
+	// the nonce carries an HMAC over every other field, so messages can't be forged or altered
+	nonce := hex.EncodeToString(random)
+	message.Nonce = nonce + signChallenge(challengeData(message, nonce))
+	return message
+}
 
-	// return nonce:spiry:sig
-	return fmt.Sprintf("%s:%s", challenge, sig)
+// challengeData is what the nonce HMAC covers
+func challengeData(m *SiweMessage, nonce string) string {
+	return strings.Join([]string{
+		nonce,
+		m.Domain,
+		m.Address,
+		m.Statement,
+		m.URI,
+		m.Version,
+		strconv.FormatInt(m.ChainID, 10),
+		m.IssuedAt.UTC().Format(time.RFC3339),
+		m.ExpirationTime.UTC().Format(time.RFC3339),
+	}, "|")
 }
 
 func signChallenge(data string) string {
 	h := hmac.New(sha256.New, challengeSigningKey)
 	h.Write([]byte(data))
-	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// requestOrigin returns scheme://host for the current request
+func requestOrigin(c echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host
 }
 
 // Login method for Ethereum authentication (to match interface)
@@ -81,18 +117,23 @@ func (a *EthAuthenticator) Login(c echo.Context, address, _ string) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
 	}
 
-	// Generate challenge
-	challenge := generateChallenge()
+	// Generate challenge and record its nonce as outstanding
+	message := generateChallenge(c, address)
+	if err := issueNonce(message.Nonce, message.Address, message.ExpirationTime); err != nil {
+		log.Println("Failed to record challenge nonce:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create challenge"})
+	}
+	challenge := message.String()
 
 	// Store challenge in session
-	session, _ := GetSession(c.Request())
+	session, _ := Session(c)
 	session.Values["ethChallenge"] = challenge
 	session.Save(c.Request(), c.Response())
 
 	// log.Printf("Generated challenge for login: %s -> %s", address, challenge)
 
 	// Return challenge to frontend for signing
-	return c.JSON(http.StatusOK, ChallengeResponse{Challenge: challenge})
+	return c.JSON(http.StatusOK, ChallengeResponse{Challenge: challenge, TypedData: LoginTypedData(message)})
 }
 
 // AuthRequestHandler handles challenge generation (used in explicit API calls)
@@ -105,44 +146,69 @@ func (a *EthAuthenticator) AuthRequestHandler(c echo.Context) error {
 	return a.Login(c, address, "")
 }
 
-func VerifyChallenge(challenge string) error {
+// VerifyChallenge parses an EIP-4361 challenge and checks every field against the
+// current request: domain, URI, version, chain ID, address, nonce and validity window.
+func VerifyChallenge(c echo.Context, challenge, address string) (*SiweMessage, error) {
 
 	log.Println("Verifying challenge", challenge)
 
-	parts := strings.Split(challenge, ":")
-	if len(parts) != 3 {
-		log.Println("Invalid challenge format")
-		return fmt.Errorf("invalid challenge format")
+	message, err := ParseSiweMessage(challenge)
+	if err != nil {
+		log.Println("Invalid challenge format:", err)
+		return nil, fmt.Errorf("invalid challenge format")
 	}
 
-	nonce := parts[0]
-	expirationStr := parts[1]
-	providedSignature := parts[2]
-
-	// Recreate the original challenge data
-	challengeData := fmt.Sprintf("%s:%s", nonce, expirationStr)
-
-	// Validate the challenge's signature
-	expectedSignature := signChallenge(challengeData)
+	// Validate the nonce's signature over the rest of the message
+	if len(message.Nonce) != 96 {
+		log.Println("Rejected: Invalid nonce length")
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	nonce, providedSignature := message.Nonce[:32], message.Nonce[32:]
+	expectedSignature := signChallenge(challengeData(message, nonce))
 	if !hmac.Equal([]byte(expectedSignature), []byte(providedSignature)) {
 		log.Println("Rejected: Challenge signature mismatch (possible tampering)")
-		return fmt.Errorf("challenge signature mismatch")
+		return nil, fmt.Errorf("challenge signature mismatch")
 	}
 
-	// Check if challenge is expired
-	expiration, err := strconv.ParseInt(expirationStr, 10, 64)
-	if err != nil {
-		log.Println("Invalid expiration timestamp in challenge")
-		return fmt.Errorf("invalid expiration timestamp")
+	// Bind the challenge to this site, so signatures can't be replayed on another domain
+	if message.Domain != c.Request().Host {
+		log.Printf("Rejected: Challenge domain %s does not match %s", message.Domain, c.Request().Host)
+		return nil, fmt.Errorf("challenge domain mismatch")
+	}
+	if message.URI != requestOrigin(c) {
+		log.Printf("Rejected: Challenge URI %s does not match %s", message.URI, requestOrigin(c))
+		return nil, fmt.Errorf("challenge uri mismatch")
+	}
+	if message.Version != "1" {
+		return nil, fmt.Errorf("unsupported challenge version")
+	}
+	if message.ChainID != siweChainID {
+		log.Printf("Rejected: Challenge chain ID %d does not match %d", message.ChainID, siweChainID)
+		return nil, fmt.Errorf("challenge chain id mismatch")
+	}
+	if !common.IsHexAddress(address) || common.HexToAddress(address).Hex() != message.Address {
+		log.Println("Rejected: Challenge address does not match login address")
+		return nil, fmt.Errorf("challenge address mismatch")
 	}
 
-	if time.Now().UTC().Unix() > expiration {
+	// Check the validity window
+	now := time.Now().UTC()
+	if message.IssuedAt.After(now.Add(30 * time.Second)) {
+		log.Println("Rejected: Challenge issued in the future")
+		return nil, fmt.Errorf("challenge not yet valid")
+	}
+	if message.ExpirationTime.IsZero() || now.After(message.ExpirationTime) {
 		log.Println("Rejected: Challenge expired")
-		return fmt.Errorf("challenge expired")
+		return nil, fmt.Errorf("challenge expired")
+	}
+
+	// Each challenge may only be answered once
+	if err := consumeNonce(message.Nonce, message.Address); err != nil {
+		return nil, err
 	}
 
 	// I was beginning to sweat. We're all good!
-	return nil
+	return message, nil
 
 }
 
@@ -162,68 +228,143 @@ func (a *EthAuthenticator) AuthCallbackHandler(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid JSON")
 	}
 
-	if err := VerifyChallenge(request.Challenge); err != nil {
+	// The challenge must be the one we issued to this browser
+	session, err := Session(c)
+	if err != nil {
+		log.Println("Error getting session:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "session not found"})
+	}
+	expected, ok := session.Values["ethChallenge"].(string)
+	if !ok || expected == "" || !hmac.Equal([]byte(expected), []byte(request.Challenge)) {
+		log.Println("Rejected: Challenge does not match the one stored in session")
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "challenge mismatch"})
+	}
+
+	message, err := VerifyChallenge(c, request.Challenge, request.Address)
+	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
 	}
 
 	log.Printf("Received MetaMask login from %s", request.Address)
 
-	if verifySignature(request.Address, request.Challenge, request.Signature) {
+	if verifySignature(message, request.Format, request.Signature) {
 		log.Println("Accepted: Signature is valid")
 
-		err := a.StoreSession(c, "", request.Address)
+		// The challenge has been used, StoreSession saves the session without it
+		delete(session.Values, "ethChallenge")
+
+		address := strings.ToLower(request.Address)
+		handle, err := completeLogin(c, "eth", address, address)
 		if err != nil {
 			log.Println("Error storing session:", err)
-			return c.JSON(http.StatusUnauthorized, map[string]string{"status": "Error storing session"})
+			return c.JSON(http.StatusUnauthorized, map[string]string{"status": "Error storing session", "error": err.Error()})
 		}
 
 		// Store Ethereum address in session
-		// session, _ := GetSession(c.Request())
+		// session, _ := Session(c)
 		// session.Values["handle"] = request.Address
 		// // set preview mode to true
 		// // session.Values["preview"] = true
 		// // Save the session
 		// session.Save(c.Request(), c.Response())
 
-		return c.JSON(http.StatusOK, map[string]string{"status": "accepted", "address": request.Address})
+		return c.JSON(http.StatusOK, map[string]string{"status": "accepted", "address": request.Address, "handle": handle})
 	} else {
 		log.Println("Rejected: Invalid signature")
 		return c.JSON(http.StatusUnauthorized, map[string]string{"status": "rejected"})
 	}
 }
 
-// Verify the signature from MetaMask
-func verifySignature(address, challenge, signature string) bool {
+// Verify the signature was made by the address in the SIWE message: either an EOA
+// signature (personal_sign or EIP-712), or a contract wallet approving it via ERC-1271
+func verifySignature(message *SiweMessage, format, signature string) bool {
 	// Validate Ethereum address format
-	if !common.IsHexAddress(address) {
+	if !common.IsHexAddress(message.Address) {
 		log.Println("Invalid Ethereum address format")
 		return false
 	}
-	normalizedAddress := common.HexToAddress(address).Hex()
-
-	// MetaMask signs a prefixed message
-	prefixedMessage := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(challenge), challenge)
-	messageHash := crypto.Keccak256Hash([]byte(prefixedMessage))
+	messageHash, err := signedHash(message, format)
+	if err != nil {
+		log.Println("Error hashing challenge:", err)
+		return false
+	}
+	return VerifySignature(common.HexToAddress(message.Address), messageHash, signature)
+}
 
+// VerifySignature checks that address signed hash, either as an EOA or, for contract wallets, via ERC-1271
+func VerifySignature(address common.Address, messageHash [32]byte, signature string) bool {
 	// Decode the signature from hex
 	sig, err := hexutil.Decode(signature)
 	if err != nil {
 		log.Println("Error decoding signature:", err)
 		return false
 	}
-	if len(sig) != 65 {
-		log.Println("Invalid signature length:", len(sig))
+
+	if len(sig) == 65 {
+		recoveredAddress, err := recoverAddress(messageHash, sig)
+		if err == nil && recoveredAddress == address {
+			log.Println("Signature is valid!")
+			return true
+		}
+		log.Println("EOA signature verification failed:", err)
+	}
+
+	// Contract wallets (Safe, other multisigs) validate signatures themselves
+	if ethereum.Reader == nil {
+		log.Println("Signature verification failed! (no chain reader configured for contract wallets)")
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	isContract, err := ethereum.IsContract(ctx, ethereum.Reader, address)
+	if err != nil || !isContract {
+		log.Println("Signature verification failed!", err)
+		return false
+	}
+	valid, err := ethereum.IsValidSignature(ctx, ethereum.Reader, address, messageHash, sig)
+	if err != nil {
+		log.Println("ERC-1271 signature verification failed:", err)
 		return false
 	}
+	if valid {
+		log.Println("Contract wallet signature is valid!")
+	}
+	return valid
+}
+
+// signedHash returns the digest the wallet signed for the given format
+func signedHash(message *SiweMessage, format string) ([32]byte, error) {
+	switch format {
+	case "", FormatPersonalSign:
+		return PersonalSignHash(message.String()), nil
+	case FormatTypedData:
+		hash, _, err := apitypes.TypedDataAndHash(LoginTypedData(message))
+		if err != nil {
+			return [32]byte{}, err
+		}
+		return [32]byte(hash), nil
+	default:
+		return [32]byte{}, fmt.Errorf("unsupported signature format %q", format)
+	}
+}
+
+// PersonalSignHash is the digest a wallet signs for personal_sign (EIP-191): MetaMask signs a prefixed message
+func PersonalSignHash(text string) [32]byte {
+	prefixedMessage := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(text), text)
+	return crypto.Keccak256Hash([]byte(prefixedMessage))
+}
+
+// recoverAddress recovers the signer of a 65 byte [R || S || V] signature
+func recoverAddress(hash [32]byte, signature []byte) (common.Address, error) {
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
 
 	// Validate the S value to prevent malleability attacks (EIP-2)
-	// r := new(big.Int).SetBytes(sig[:32])  // R value
 	s := new(big.Int).SetBytes(sig[32:64])                    // S value
 	curveOrderHalf := new(big.Int).Rsh(secp256k1.S256().N, 1) // Half of curve order
-
 	if s.Cmp(curveOrderHalf) > 0 {
-		log.Println("Invalid signature: S value is too large")
-		return false
+		return common.Address{}, fmt.Errorf("invalid signature: S value is too large")
 	}
 
 	// Adjust V value (MetaMask sometimes returns 27/28)
@@ -232,79 +373,28 @@ func verifySignature(address, challenge, signature string) bool {
 	}
 
 	// Recover the public key
-	publicKey, err := crypto.SigToPub(messageHash.Bytes(), sig)
+	publicKey, err := crypto.SigToPub(hash[:], sig)
 	if err != nil || publicKey == nil {
-		log.Println("Error recovering public key:", err)
-		return false
+		return common.Address{}, fmt.Errorf("error recovering public key: %v", err)
 	}
 
 	// Convert public key to Ethereum address
-	recoveredAddress := crypto.PubkeyToAddress(*publicKey).Hex()
-
-	// Compare addresses (case insensitive)
-	if strings.EqualFold(recoveredAddress, normalizedAddress) {
-		log.Println("Signature is valid!")
-		return true
-	}
-
-	log.Println("Signature verification failed!")
-	return false
+	return crypto.PubkeyToAddress(*publicKey), nil
 }
 
 // StoreSession stores the authenticated Ethereum address in a session
 func (a *EthAuthenticator) StoreSession(c echo.Context, _, address string) error {
-	log.Printf("Storing session for: %s", address)
-
-	store := GetSessionStore()
-	session, err := store.Get(c.Request(), "session")
-	if err != nil {
-		log.Printf("Error getting session: %v", err)
-		return err
-	}
-
-	session.Values["handle"] = address
-	session.Values["preview"] = false
-
-	// Save session and check for errors
-	if err := session.Save(c.Request(), c.Response()); err != nil {
-		log.Printf("Error saving session: %v", err)
-		return err
-	}
-
-	// Log cookies after session is stored
-	for _, cookie := range c.Cookies() {
-		log.Printf("Cookie Set: Name=%s, Value=%s, Domain=%s, Path=%s, Secure=%t, HttpOnly=%t, SameSite=%v\n",
-			cookie.Name, cookie.Value, cookie.Domain, cookie.Path, cookie.Secure, cookie.HttpOnly, cookie.SameSite)
-	}
-
-	log.Println("Session stored successfully.")
-	return nil
+	return storeHandle(c, "eth", address)
 }
 
 // ValidateSession for Ethereum authentication
 func (a *EthAuthenticator) ValidateSession(token string) bool {
-	return token != "" // Future token validation can be added
+	return activeSession(token, "")
 }
 
 // Logout clears the session for Ethereum users
 func (a *EthAuthenticator) Logout(c echo.Context) error {
-	session, _ := GetSession(c.Request())
-
-	if ethAddress, ok := session.Values["ethAddress"].(string); ok {
-		log.Printf("Logging out Ethereum user: %s", ethAddress)
-	} else {
-		log.Println("Logging out anonymous session")
-	}
-
-	delete(session.Values, "ethAddress")
-	session.Options.MaxAge = -1
-	err := session.Save(c.Request(), c.Response())
-	if err != nil {
-		log.Println("Failed to save session:", err)
-		return c.JSON(http.StatusInternalServerError, "Error logging out")
-	}
-
-	return c.Redirect(http.StatusFound, "/")
+	return clearSession(c)
 }
 
 func (a *EthAuthenticator) PasswordReset(_ string) error {
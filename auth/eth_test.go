@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	ethereum "dreamfriday/ethereum"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// contract wallets for ERC-1271 logins
+var (
+	// isValidSignature returns the magic value for anything:
+	// PUSH4 0x1626ba7e PUSH1 224 SHL PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	approvingWallet     = common.HexToAddress("0x00000000000000000000000000000000000a9970")
+	approvingWalletCode = common.FromHex("0x631626ba7e60e01b60005260206000f3")
+
+	// isValidSignature returns zero bytes: PUSH1 32 PUSH1 0 RETURN
+	refusingWallet     = common.HexToAddress("0x000000000000000000000000000000000000dead")
+	refusingWalletCode = common.FromHex("0x60206000f3")
+)
+
+// useContractWallets points ethereum.Reader at a simulated chain holding the test contract wallets
+func useContractWallets(t *testing.T) {
+	t.Helper()
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		approvingWallet: {Code: approvingWalletCode, Balance: big.NewInt(0)},
+		refusingWallet:  {Code: refusingWalletCode, Balance: big.NewInt(0)},
+	})
+	previous := ethereum.Reader
+	ethereum.SetReader(backend.Client())
+	t.Cleanup(func() {
+		ethereum.SetReader(previous)
+		backend.Close()
+	})
+}
+
+// personalSign signs a digest the way wallets return it, with a 27/28 recovery id
+func personalSign(t *testing.T, key *ecdsa.PrivateKey, hash [32]byte) string {
+	t.Helper()
+	signature, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature[64] += 27
+	return hexutil.Encode(signature)
+}
+
+func TestEthLogin(t *testing.T) {
+	useContractWallets(t)
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	eoa := crypto.PubkeyToAddress(key.PublicKey)
+
+	// sign returns the signature a wallet would send for a challenge
+	type signer func(t *testing.T, message *SiweMessage, format string) string
+	signedBy := func(key *ecdsa.PrivateKey) signer {
+		return func(t *testing.T, message *SiweMessage, format string) string {
+			hash, err := signedHash(message, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return personalSign(t, key, hash)
+		}
+	}
+	contractSignature := func(t *testing.T, _ *SiweMessage, _ string) string {
+		return hexutil.Encode(make([]byte, 65))
+	}
+
+	tests := []struct {
+		name       string
+		address    common.Address
+		format     string
+		sign       signer
+		wantStatus int
+	}{
+		{name: "personal_sign", address: eoa, sign: signedBy(key), wantStatus: http.StatusOK},
+		{name: "eip712", address: eoa, format: FormatTypedData, sign: signedBy(key), wantStatus: http.StatusOK},
+		{name: "eip712 signature sent as personal_sign", address: eoa, format: FormatPersonalSign, sign: func(t *testing.T, m *SiweMessage, _ string) string {
+			return signedBy(key)(t, m, FormatTypedData)
+		}, wantStatus: http.StatusUnauthorized},
+		{name: "signed by another key", address: eoa, sign: signedBy(other), wantStatus: http.StatusUnauthorized},
+		{name: "unknown format", address: eoa, format: "eth_sign", sign: func(t *testing.T, m *SiweMessage, _ string) string {
+			return signedBy(key)(t, m, FormatPersonalSign)
+		}, wantStatus: http.StatusUnauthorized},
+		{name: "contract wallet approves", address: approvingWallet, format: FormatTypedData, sign: contractSignature, wantStatus: http.StatusOK},
+		{name: "contract wallet refuses", address: refusingWallet, sign: contractSignature, wantStatus: http.StatusUnauthorized},
+		{name: "address without code", address: common.HexToAddress("0x0000000000000000000000000000000000000001"), sign: contractSignature, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser()
+			authenticator := &EthAuthenticator{}
+
+			c, rec := b.request(http.MethodGet, "/auth/request?address="+tt.address.Hex(), "")
+			if err := authenticator.AuthRequestHandler(c); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("challenge request: %v, status %d", err, rec.Code)
+			}
+			b.done(rec)
+			var challenge ChallengeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &challenge); err != nil {
+				t.Fatal(err)
+			}
+			message, err := ParseSiweMessage(challenge.Challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request := AuthRequest{
+				Address:   strings.ToLower(tt.address.Hex()),
+				Challenge: challenge.Challenge,
+				Signature: tt.sign(t, message, tt.format),
+				Format:    tt.format,
+			}
+			body, _ := json.Marshal(request)
+			c, rec = b.request(http.MethodPost, "/auth/callback", string(body))
+			authenticator.AuthCallbackHandler(c)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			b.done(rec)
+
+			wantHandle := ""
+			if tt.wantStatus == http.StatusOK {
+				wantHandle = strings.ToLower(tt.address.Hex())
+			}
+			if got := b.handle(); got != wantHandle {
+				t.Fatalf("logged in as %q, want %q", got, wantHandle)
+			}
+
+			// a challenge can only be answered once
+			c, rec = b.request(http.MethodPost, "/auth/callback", string(body))
+			authenticator.AuthCallbackHandler(c)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("replayed callback status = %d, want 401", rec.Code)
+			}
+		})
+	}
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	tests := []struct {
+		name    string
+		alter   func(challenge string) string
+		host    string
+		login   string
+		wantErr string
+	}{
+		{name: "valid", alter: func(s string) string { return s }},
+		{name: "issued for another domain", alter: func(s string) string { return s }, host: "other.example", wantErr: "domain mismatch"},
+		{name: "edited statement", alter: func(s string) string { return strings.Replace(s, "Sign in to", "Log in to", 1) }, wantErr: "signature mismatch"},
+		{name: "other chain", alter: func(s string) string { return strings.Replace(s, "Chain ID: 1\n", "Chain ID: 5\n", 1) }, wantErr: "signature mismatch"},
+		{name: "other address", alter: func(s string) string { return s }, login: "0x0000000000000000000000000000000000000001", wantErr: "address mismatch"},
+		{name: "not siwe", alter: func(string) string { return "hello" }, wantErr: "invalid challenge format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newBrowser().request(http.MethodGet, "/", "")
+			message := generateChallenge(c, address)
+			if err := issueNonce(message.Nonce, message.Address, message.ExpirationTime); err != nil {
+				t.Fatal(err)
+			}
+
+			c, _ = newBrowser().request(http.MethodPost, "/auth/callback", "")
+			if tt.host != "" {
+				c.Request().Host = tt.host
+			}
+			login := address
+			if tt.login != "" {
+				login = tt.login
+			}
+			_, err := VerifyChallenge(c, tt.alter(message.String()), login)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecoverAddressRejectsHighS(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	hash := PersonalSignHash("hello")
+	signature, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered, err := recoverAddress(hash, signature); err != nil || recovered != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("recovered %s, %v", recovered.Hex(), err)
+	}
+
+	// the same signature with s mirrored to the upper half of the curve order is also valid ECDSA
+	n := crypto.S256().Params().N
+	s := new(big.Int).Sub(n, new(big.Int).SetBytes(signature[32:64]))
+	malleable := append([]byte(nil), signature...)
+	s.FillBytes(malleable[32:64])
+	malleable[64] ^= 1
+	if _, err := recoverAddress(hash, malleable); err == nil {
+		t.Fatal("accepted a high-s signature")
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	models "dreamfriday/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// how long a signed publish manifest can be used for
+const manifestMaxAge = 10 * time.Minute
+
+// NewManifest returns the unsigned manifest for publishing site's preview data as cid
+func NewManifest(site *models.Site, cid string) *models.PublishManifest {
+	return &models.PublishManifest{
+		Site:        site.Name,
+		CID:         cid,
+		PreviousCID: site.IPFSHash,
+		Timestamp:   time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// VerifyManifest checks that a publish manifest is recent and was signed by one of handle's wallets
+func VerifyManifest(manifest *models.PublishManifest, handle string) error {
+	age := time.Since(manifest.Timestamp)
+	if age > manifestMaxAge {
+		return fmt.Errorf("manifest expired")
+	}
+	if age < -30*time.Second {
+		return fmt.Errorf("manifest timestamp is in the future")
+	}
+	if !common.IsHexAddress(manifest.Signer) {
+		return fmt.Errorf("manifest signer must be an address")
+	}
+	signer := strings.ToLower(common.HexToAddress(manifest.Signer).Hex())
+	if !contains(Wallets(handle), signer) {
+		return fmt.Errorf("%s is not a wallet of the publishing user", signer)
+	}
+	if !VerifySignature(common.HexToAddress(signer), PersonalSignHash(manifest.Message()), manifest.Signature) {
+		return fmt.Errorf("invalid manifest signature")
+	}
+	return nil
+}
+
+// Wallets returns the addresses a user can sign with, see models.Wallets
+func Wallets(handle string) []string {
+	return models.Wallets(handle)
+}
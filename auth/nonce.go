@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	database "dreamfriday/database"
+)
+
+// issuedNonce records a challenge nonce until it is used or expires
+type issuedNonce struct {
+	Address string    `json:"address"`
+	Expires time.Time `json:"expires"`
+}
+
+var (
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+)
+
+// issueNonce records a nonce as outstanding for address until expires
+func issueNonce(nonce, address string, expires time.Time) error {
+	pruneExpiredNonces()
+	return database.Put("AuthNonces", nonce, issuedNonce{Address: address, Expires: expires})
+}
+
+// consumeNonce removes a nonce, failing if it was never issued, was already used,
+// belongs to another address or has expired
+func consumeNonce(nonce, address string) error {
+	issued, err := takeNonce(nonce)
+	if err != nil {
+		return err
+	}
+	if issued.Address != address {
+		log.Println("Rejected: Nonce was issued to another address")
+		return fmt.Errorf("challenge address mismatch")
+	}
+	return nil
+}
+
+// takeNonce removes an unexpired nonce and returns what it was issued for
+func takeNonce(nonce string) (*issuedNonce, error) {
+	var issued issuedNonce
+	if err := database.Take("AuthNonces", nonce, &issued); err != nil {
+		log.Println("Rejected: Nonce unknown or already used")
+		return nil, fmt.Errorf("challenge already used or unknown")
+	}
+	if time.Now().After(issued.Expires) {
+		log.Println("Rejected: Nonce expired")
+		return nil, fmt.Errorf("challenge expired")
+	}
+	return &issued, nil
+}
+
+// pruneExpiredNonces drops challenges that were never answered, at most once a minute
+func pruneExpiredNonces() {
+	pruneMu.Lock()
+	if time.Since(lastPrune) < time.Minute {
+		pruneMu.Unlock()
+		return
+	}
+	lastPrune = time.Now()
+	pruneMu.Unlock()
+
+	now := time.Now()
+	err := database.DeleteWhere("AuthNonces", func(_ string, value []byte) bool {
+		var issued issuedNonce
+		if err := json.Unmarshal(value, &issued); err != nil {
+			return true
+		}
+		return now.After(issued.Expires)
+	})
+	if err != nil {
+		log.Println("Failed to prune expired nonces:", err)
+	}
+}
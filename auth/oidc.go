@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OIDCConfig configures an OpenID Connect identity provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // defaults to <origin>/auth/oidc/callback
+	Scopes       []string
+}
+
+// OIDCConfigFromEnv reads OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and OIDC_SCOPES
+func OIDCConfigFromEnv() OIDCConfig {
+	config := OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       []string{"openid", "email"},
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(scopes)
+	}
+	return config
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCClaims are the ID token claims we rely on
+type OIDCClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	Expiry   int64    `json:"exp"`
+	Nonce    string   `json:"nonce"`
+	Email    string   `json:"email"`
+}
+
+// audience accepts both the string and array forms of "aud"
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// OIDCAuthenticator logs users in with the authorization code flow of an OpenID Connect provider
+type OIDCAuthenticator struct {
+	config    OIDCConfig
+	discovery oidcDiscovery
+	client    *http.Client
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey // JWKS by key id
+}
+
+// NewOIDCAuthenticator discovers the issuer's endpoints
+func NewOIDCAuthenticator(config OIDCConfig) (*OIDCAuthenticator, error) {
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER and OIDC_CLIENT_ID are required")
+	}
+	a := &OIDCAuthenticator{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	if err := a.getJSON(issuer+"/.well-known/openid-configuration", &a.discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(a.discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovered issuer %s does not match %s", a.discovery.Issuer, issuer)
+	}
+	return a, nil
+}
+
+func (a *OIDCAuthenticator) getJSON(uri string, out interface{}) error {
+	resp, err := a.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", uri, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (a *OIDCAuthenticator) redirectURL(c echo.Context) string {
+	if a.config.RedirectURL != "" {
+		return a.config.RedirectURL
+	}
+	return requestOrigin(c) + "/auth/oidc/callback"
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Login redirects to the provider's authorization endpoint (to match interface)
+func (a *OIDCAuthenticator) Login(c echo.Context, _, _ string) error {
+	state, nonce := randomToken(), randomToken()
+
+	session, err := Session(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
+	}
+	session.Values["oidcState"] = state
+	session.Values["oidcNonce"] = nonce
+	if err := session.Save(c.Request(), c.Response()); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to save session")
+	}
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {a.config.ClientID},
+		"redirect_uri":  {a.redirectURL(c)},
+		"scope":         {strings.Join(a.config.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	return c.Redirect(http.StatusFound, a.discovery.AuthorizationEndpoint+"?"+query.Encode())
+}
+
+// CallbackHandler exchanges the authorization code and logs in the ID token's subject
+func (a *OIDCAuthenticator) CallbackHandler(c echo.Context) error {
+	if errParam := c.QueryParam("error"); errParam != "" {
+		log.Println("OIDC provider returned error:", errParam)
+		return c.String(http.StatusUnauthorized, "Login was not completed")
+	}
+
+	session, err := Session(c)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
+	}
+	state, _ := session.Values["oidcState"].(string)
+	nonce, _ := session.Values["oidcNonce"].(string)
+	delete(session.Values, "oidcState")
+	delete(session.Values, "oidcNonce")
+
+	if state == "" || !hmac.Equal([]byte(state), []byte(c.QueryParam("state"))) {
+		log.Println("Rejected: OIDC state mismatch")
+		return c.String(http.StatusUnauthorized, "Invalid login state")
+	}
+
+	idToken, err := a.exchangeCode(c, c.QueryParam("code"))
+	if err != nil {
+		log.Println("OIDC code exchange failed:", err)
+		return c.String(http.StatusUnauthorized, "Login failed")
+	}
+	claims, err := a.VerifyIDToken(idToken, nonce)
+	if err != nil {
+		log.Println("Rejected: invalid ID token:", err)
+		return c.String(http.StatusUnauthorized, "Login failed")
+	}
+
+	if _, err := completeLogin(c, "oidc", claims.Subject, "oidc:"+claims.Subject); err != nil {
+		log.Println("Error storing session:", err)
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+	return c.Redirect(http.StatusFound, "/admin")
+}
+
+func (a *OIDCAuthenticator) exchangeCode(c echo.Context, code string) (string, error) {
+	if code == "" {
+		return "", fmt.Errorf("missing authorization code")
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {a.redirectURL(c)},
+	}
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodPost, a.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// VerifyIDToken checks an RS256 ID token's signature against the issuer's JWKS,
+// and its issuer, audience, expiry and nonce
+func (a *OIDCAuthenticator) VerifyIDToken(idToken, nonce string) (*OIDCClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	var claims OIDCClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if claims.Issuer != a.discovery.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+	validAudience := false
+	for _, aud := range claims.Audience {
+		if aud == a.config.ClientID {
+			validAudience = true
+		}
+	}
+	if !validAudience {
+		return nil, fmt.Errorf("token not issued for this client")
+	}
+	if time.Now().After(time.Unix(claims.Expiry, 0).Add(time.Minute)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if nonce == "" || !hmac.Equal([]byte(nonce), []byte(claims.Nonce)) {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// key returns the signing key for kid, refreshing the JWKS once if it is unknown (key rotation)
+func (a *OIDCAuthenticator) key(kid string) (*rsa.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := a.getJSON(a.discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		a.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// StoreSession stores the authenticated handle in a session
+func (a *OIDCAuthenticator) StoreSession(c echo.Context, _, handle string) error {
+	return storeHandle(c, "oidc", handle)
+}
+
+// ValidateSession for OIDC authentication
+func (a *OIDCAuthenticator) ValidateSession(token string) bool {
+	return activeSession(token, "")
+}
+
+// Logout clears the session for OIDC users
+func (a *OIDCAuthenticator) Logout(c echo.Context) error {
+	return clearSession(c)
+}
+
+func (a *OIDCAuthenticator) PasswordReset(_ string) error {
+	log.Println("Password reset is managed by the OIDC provider.")
+	return nil
+}
+
+func (a *OIDCAuthenticator) Register(_, _ string) error {
+	log.Println("Register is managed by the OIDC provider.")
+	return nil
+}
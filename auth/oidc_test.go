@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOIDC is a stand-in OpenID Connect provider: discovery, JWKS and a token endpoint
+// that answers one authorization code with whatever ID token the test issued for it
+type fakeOIDC struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	keys   map[string]*rsa.PrivateKey // published in the JWKS
+	tokens map[string]string          // authorization code -> id_token
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	t.Helper()
+	provider := &fakeOIDC{keys: make(map[string]*rsa.PrivateKey), tokens: make(map[string]string)}
+	provider.addKey(t, "k1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                provider.server.URL,
+			AuthorizationEndpoint: provider.server.URL + "/authorize",
+			TokenEndpoint:         provider.server.URL + "/token",
+			JWKSURI:               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		var keys []map[string]string
+		for kid, key := range provider.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "authorization_code" {
+			http.Error(w, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+		provider.mu.Lock()
+		token, ok := provider.tokens[r.PostFormValue("code")]
+		delete(provider.tokens, r.PostFormValue("code"))
+		provider.mu.Unlock()
+		if !ok {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+	})
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (p *fakeOIDC) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.keys[kid] = key
+	p.mu.Unlock()
+}
+
+// issue makes the token endpoint answer code with idToken
+func (p *fakeOIDC) issue(code, idToken string) {
+	p.mu.Lock()
+	p.tokens[code] = idToken
+	p.mu.Unlock()
+}
+
+// claims returns valid claims for subject, for the test to alter
+func (p *fakeOIDC) claims(subject, nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   p.server.URL,
+		"sub":   subject,
+		"aud":   "client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+// sign returns an ID token for claims signed with key kid
+func (p *fakeOIDC) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		// sign with a key nobody published
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *fakeOIDC) authenticator(t *testing.T) *OIDCAuthenticator {
+	t.Helper()
+	authenticator, err := NewOIDCAuthenticator(OIDCConfig{
+		Issuer:       p.server.URL + "/",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator
+}
+
+func TestNewOIDCAuthenticator(t *testing.T) {
+	provider := newFakeOIDC(t)
+	tests := []struct {
+		name   string
+		config OIDCConfig
+	}{
+		{"missing issuer", OIDCConfig{ClientID: "client"}},
+		{"missing client", OIDCConfig{Issuer: provider.server.URL}},
+		{"discovery fails", OIDCConfig{Issuer: provider.server.URL + "/missing", ClientID: "client"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewOIDCAuthenticator(tt.config); err == nil {
+			t.Errorf("%s: created an authenticator", tt.name)
+		}
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider := newFakeOIDC(t)
+	authenticator := provider.authenticator(t)
+
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := provider.claims("subject", "nonce")
+		for key, value := range changes {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr string
+	}{
+		{name: "valid", token: func() string { return provider.sign(t, "RS256", "k1", with(nil)) }, nonce: "nonce"},
+		{name: "audience list", token: func() string {
+			return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"aud": []string{"other", "client"}}))
+		}, nonce: "nonce"},
+		{name: "rotated key", token: func() string {
+			provider.addKey(t, "k2")
+			return provider.sign(t, "RS256", "k2", with(nil))
+		}, nonce: "nonce"},
+		{name: "unpublished key", token: func() string { return provider.sign(t, "RS256", "k9", with(nil)) }, nonce: "nonce", wantErr: "unknown signing key"},
+		{name: "wrong algorithm", token: func() string { return provider.sign(t, "HS256", "k1", with(nil)) }, nonce: "nonce", wantErr: "unsupported alg"},
+		{name: "tampered claims", token: func() string {
+			parts := strings.Split(provider.sign(t, "RS256", "k1", with(nil)), ".")
+			payload, _ := json.Marshal(with(map[string]interface{}{"sub": "someone else"}))
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+		}, nonce: "nonce", wantErr: "signature verification failed"},
+		{name: "other issuer", token: func() string {
+			return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"iss": "https://evil.example"}))
+		}, nonce: "nonce", wantErr: "unexpected issuer"},
+		{name: "other client", token: func() string {
+			return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"aud": "other"}))
+		}, nonce: "nonce", wantErr: "not issued for this client"},
+		{name: "expired", token: func() string {
+			return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}))
+		}, nonce: "nonce", wantErr: "expired"},
+		{name: "other nonce", token: func() string { return provider.sign(t, "RS256", "k1", with(nil)) }, nonce: "another", wantErr: "nonce mismatch"},
+		{name: "no nonce expected", token: func() string { return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"nonce": ""})) }, nonce: "", wantErr: "nonce mismatch"},
+		{name: "no subject", token: func() string { return provider.sign(t, "RS256", "k1", with(map[string]interface{}{"sub": nil})) }, nonce: "nonce", wantErr: "no subject"},
+		{name: "malformed", token: func() string { return "not.a-token" }, nonce: "nonce", wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := authenticator.VerifyIDToken(tt.token(), tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "subject" {
+				t.Fatalf("subject = %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newFakeOIDC(t)
+	authenticator := provider.authenticator(t)
+
+	tests := []struct {
+		name       string
+		subject    string
+		state      func(sent string) string
+		error      string
+		wantStatus int
+		wantHandle string
+	}{
+		{name: "code flow logs in", subject: "alice", state: func(sent string) string { return sent }, wantStatus: http.StatusFound, wantHandle: "oidc:alice"},
+		{name: "state must match", subject: "bob", state: func(string) string { return "forged" }, wantStatus: http.StatusUnauthorized},
+		{name: "provider errors", subject: "carol", state: func(sent string) string { return sent }, error: "access_denied", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser()
+			c, rec := b.request(http.MethodGet, "/login/oidc", "")
+			if err := authenticator.Login(c, "", ""); err != nil {
+				t.Fatal(err)
+			}
+			b.done(rec)
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil || !strings.HasPrefix(location.String(), provider.server.URL+"/authorize?") {
+				t.Fatalf("redirected to %q", rec.Header().Get("Location"))
+			}
+			query := location.Query()
+			if query.Get("client_id") != "client" || query.Get("scope") != "openid email" || query.Get("redirect_uri") != "http://example.com/auth/oidc/callback" {
+				t.Fatalf("authorization request %v", query)
+			}
+
+			// the provider authenticates the user and sends them back with a code
+			code := randomToken()
+			provider.issue(code, provider.sign(t, "RS256", "k1", provider.claims(tt.subject, query.Get("nonce"))))
+			callback := url.Values{"code": {code}, "state": {tt.state(query.Get("state"))}}
+			if tt.error != "" {
+				callback = url.Values{"error": {tt.error}, "state": {query.Get("state")}}
+			}
+
+			c, rec = b.request(http.MethodGet, "/auth/oidc/callback?"+callback.Encode(), "")
+			authenticator.CallbackHandler(c)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			b.done(rec)
+			if got := b.handle(); got != tt.wantHandle {
+				t.Fatalf("logged in as %q, want %q", got, tt.wantHandle)
+			}
+		})
+	}
+}
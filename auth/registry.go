@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	models "dreamfriday/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// providers holds every enabled authenticator by name, in the order they were registered
+var (
+	providers     = make(map[string]Authenticator)
+	providerNames []string
+)
+
+// RegisterProvider enables an authenticator under name
+func RegisterProvider(name string, authenticator Authenticator) {
+	if _, exists := providers[name]; !exists {
+		providerNames = append(providerNames, name)
+	}
+	providers[name] = authenticator
+	log.Println("Enabled auth provider:", name)
+}
+
+// GetProvider returns the authenticator registered under name
+func GetProvider(name string) (Authenticator, bool) {
+	authenticator, ok := providers[name]
+	return authenticator, ok
+}
+
+// Providers lists the names of the enabled authenticators
+func Providers() []string {
+	return append([]string(nil), providerNames...)
+}
+
+// InitProviders enables the providers listed in AUTH_PROVIDERS (default "eth")
+func InitProviders() {
+	names := os.Getenv("AUTH_PROVIDERS")
+	if names == "" {
+		names = "eth"
+	}
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "eth":
+			RegisterProvider("eth", &EthAuthenticator{})
+		case "email":
+			RegisterProvider("email", NewEmailAuthenticator(EmailConfigFromEnv()))
+		case "oidc":
+			authenticator, err := NewOIDCAuthenticator(OIDCConfigFromEnv())
+			if err != nil {
+				log.Fatalf("Failed to initialize OIDC provider: %v", err)
+			}
+			RegisterProvider("oidc", authenticator)
+		case "webauthn":
+			RegisterProvider("webauthn", NewWebAuthnAuthenticator(WebAuthnConfigFromEnv()))
+		case "":
+		default:
+			log.Fatalf("Unknown auth provider %q in AUTH_PROVIDERS", name)
+		}
+	}
+}
+
+// storeHandle saves the logged in handle and the provider that authenticated it
+func storeHandle(c echo.Context, provider, handle string) error {
+	log.Printf("Storing session for: %s (%s)", handle, provider)
+
+	session, err := Session(c)
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+		return err
+	}
+
+	// a new session ID on every login, so a session fixed before login is useless after it
+	if oldID, ok := session.Values["sid"].(string); ok && oldID != "" {
+		models.DeleteSession(oldID)
+	}
+	sid, err := createSession(c, handle, provider)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		return err
+	}
+
+	session.Values["handle"] = handle
+	session.Values["provider"] = provider
+	session.Values["sid"] = sid
+	session.Values["preview"] = false
+
+	// Save session and check for errors
+	if err := session.Save(c.Request(), c.Response()); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return err
+	}
+
+	log.Println("Session stored successfully.")
+	return nil
+}
+
+// clearSession logs out the current session
+func clearSession(c echo.Context) error {
+	session, _ := Session(c)
+
+	if handle, ok := session.Values["handle"].(string); ok {
+		log.Printf("Logging out user: %s", handle)
+	} else {
+		log.Println("Logging out anonymous session")
+	}
+
+	if sid, ok := session.Values["sid"].(string); ok && sid != "" {
+		if err := models.DeleteSession(sid); err != nil {
+			log.Println("Failed to delete session:", err)
+		}
+	}
+	delete(session.Values, "handle")
+	delete(session.Values, "sid")
+	delete(session.Values, "webauthnChallenge")
+	delete(session.Values, "webauthnHandle")
+	session.Options.MaxAge = -1
+	err := session.Save(c.Request(), c.Response())
+	if err != nil {
+		log.Println("Failed to save session:", err)
+		return c.JSON(http.StatusInternalServerError, "Error logging out")
+	}
+
+	return c.Redirect(http.StatusFound, "/")
+}
+
+// StartLinking marks the session so the next successful login, with any provider,
+// is linked to the currently logged in user instead of logging in as someone else
+func StartLinking(c echo.Context) error {
+	handle, err := GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	session, _ := Session(c)
+	session.Values["linkTo"] = handle
+	if err := session.Save(c.Request(), c.Response()); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save session"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "linking", "providers": Providers()})
+}
+
+// completeLogin maps an identity proven by a provider to a user and stores the session.
+// Linked identities log in as the user they are linked to; unknown identities either
+// link to the user who started linking, or become a new user with defaultHandle.
+func completeLogin(c echo.Context, provider, subject, defaultHandle string) (string, error) {
+	// an authenticator that isn't registered, because AUTH_PROVIDERS leaves it out, can't log anyone in
+	if _, enabled := GetProvider(provider); !enabled {
+		return "", fmt.Errorf("%s login is not enabled", provider)
+	}
+	session, err := Session(c)
+	if err != nil {
+		return "", err
+	}
+	linkTo, _ := session.Values["linkTo"].(string)
+	delete(session.Values, "linkTo")
+
+	handle, err := models.FindIdentity(provider, subject)
+	known := err == nil
+	switch {
+	case known && linkTo != "" && handle != linkTo:
+		return "", fmt.Errorf("this %s login is already linked to another account", provider)
+	case known:
+		// known identity
+	case linkTo != "":
+		handle = linkTo
+	default:
+		handle = defaultHandle
+	}
+
+	// RESTRICT_LOGIN_TO_ADDRESS applies whichever provider proved the identity
+	if restrict := GetRestrictAddress(); restrict != "" && !strings.EqualFold(handle, restrict) {
+		log.Printf("Login as %s via %s does not match restricted address", handle, provider)
+		return "", fmt.Errorf("unauthorized")
+	}
+
+	if !known {
+		if err := models.LinkIdentity(handle, provider, subject); err != nil {
+			return "", err
+		}
+	}
+
+	if err := storeHandle(c, provider, handle); err != nil {
+		return "", err
+	}
+	return handle, nil
+}
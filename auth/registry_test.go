@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	models "dreamfriday/models"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestCompleteLogin(t *testing.T) {
+	if err := models.LinkIdentity("0x00000000000000000000000000000000000000a1", "oidc", "known"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		subject    string
+		linkTo     string
+		restrict   string
+		wantHandle string
+		wantErr    bool
+	}{
+		{name: "new identity becomes a user", subject: "new", wantHandle: "oidc:new"},
+		{name: "known identity logs in as its user", subject: "known", wantHandle: "0x00000000000000000000000000000000000000a1"},
+		{name: "linking attaches a new identity", subject: "linked", linkTo: "email:someone@example.com", wantHandle: "email:someone@example.com"},
+		{name: "linking can't take another user's identity", subject: "known", linkTo: "email:someone@example.com", wantErr: true},
+		{name: "restricted address is enforced", subject: "restricted", restrict: "0x00000000000000000000000000000000000000b2", wantErr: true},
+		{name: "restricted address matches case insensitively", subject: "known", restrict: "0x00000000000000000000000000000000000000A1", wantHandle: "0x00000000000000000000000000000000000000a1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restrictLogin(t, tt.restrict)
+			b := newBrowser()
+			c, rec := b.request(http.MethodGet, "/", "")
+			if tt.linkTo != "" {
+				session, _ := Session(c)
+				session.Values["linkTo"] = tt.linkTo
+			}
+
+			handle, err := completeLogin(c, "oidc", tt.subject, "oidc:"+tt.subject)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("logged in as %s, want an error", handle)
+				}
+				if _, err := models.FindIdentity("oidc", tt.subject); err == nil && tt.subject != "known" {
+					t.Fatal("a rejected login linked its identity")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.done(rec)
+			if handle != tt.wantHandle || b.handle() != tt.wantHandle {
+				t.Fatalf("handle = %q, session handle = %q, want %q", handle, b.handle(), tt.wantHandle)
+			}
+			if linked, _ := models.FindIdentity("oidc", tt.subject); linked != tt.wantHandle {
+				t.Fatalf("identity linked to %q, want %q", linked, tt.wantHandle)
+			}
+		})
+	}
+}
+
+func TestDisabledProviderLogin(t *testing.T) {
+	enableOnly(t, "email")
+	key, _ := crypto.GenerateKey()
+	address := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+
+	// a wallet answers the challenge correctly, but AUTH_PROVIDERS left eth out
+	b := newBrowser()
+	authenticator := &EthAuthenticator{}
+	c, rec := b.request(http.MethodGet, "/auth/request?address="+address, "")
+	if err := authenticator.AuthRequestHandler(c); err != nil {
+		t.Fatal(err)
+	}
+	b.done(rec)
+	var challenge ChallengeResponse
+	json.Unmarshal(rec.Body.Bytes(), &challenge)
+	message, err := ParseSiweMessage(challenge.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := signedHash(message, FormatPersonalSign)
+	body, _ := json.Marshal(AuthRequest{Address: address, Challenge: challenge.Challenge, Signature: personalSign(t, key, hash)})
+
+	c, rec = b.request(http.MethodPost, "/auth/callback", string(body))
+	authenticator.AuthCallbackHandler(c)
+	b.done(rec)
+	if rec.Code != http.StatusUnauthorized || b.handle() != "" {
+		t.Fatalf("eth login while disabled: status %d, logged in as %q", rec.Code, b.handle())
+	}
+	if _, err := models.FindIdentity("eth", address); err == nil {
+		t.Fatal("a disabled provider linked an identity")
+	}
+
+	if _, err := completeLogin(c, "email", "someone@example.com", "email:someone@example.com"); err != nil {
+		t.Fatalf("enabled provider: %v", err)
+	}
+}
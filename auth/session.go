@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	models "dreamfriday/models"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+// The session cookie only carries a random session ID ("sid") next to the handle;
+// the session itself lives in the Bolt "Sessions" bucket so it can be listed and revoked.
+
+// sessionMaxIdle is how long a session survives without being seen, matching the cookie MaxAge
+var sessionMaxIdle = 3 * time.Hour
+
+// LastSeen is written at most this often per session. Idle sessions expire after hours,
+// so minutes of slack are plenty and keep Bolt writes down.
+const sessionTouchInterval = 5 * time.Minute
+
+var (
+	sessionPruneMu   sync.Mutex
+	lastSessionPrune time.Time
+)
+
+// createSession stores a new server-side session and returns its ID
+func createSession(c echo.Context, handle, provider string) (string, error) {
+	pruneSessions()
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:        hex.EncodeToString(random),
+		Handle:    handle,
+		Provider:  provider,
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+	if err := models.SaveSession(session); err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+	return session.ID, nil
+}
+
+// verifySession logs the cookie session out (in memory, for this request) unless it
+// refers to a live server-side session for the same handle
+func verifySession(session *sessions.Session) {
+	handle, ok := session.Values["handle"].(string)
+	if !ok || handle == "" {
+		return
+	}
+	sid, _ := session.Values["sid"].(string)
+	if activeSession(sid, handle) {
+		return
+	}
+	log.Printf("Session for %s was revoked or expired", handle)
+	delete(session.Values, "handle")
+	delete(session.Values, "provider")
+	delete(session.Values, "sid")
+}
+
+// activeSession reports whether sid is a live session, for handle if one is given, and records that it was seen
+func activeSession(sid, handle string) bool {
+	if sid == "" {
+		return false
+	}
+	record, err := models.GetSession(sid)
+	if err != nil {
+		return false
+	}
+	if handle != "" && record.Handle != handle {
+		return false
+	}
+	if time.Since(record.LastSeen) > sessionMaxIdle {
+		models.DeleteSession(sid)
+		return false
+	}
+	if time.Since(record.LastSeen) > sessionTouchInterval {
+		record.LastSeen = time.Now()
+		if err := models.SaveSession(record); err != nil {
+			log.Println("Failed to update session:", err)
+		}
+	}
+	return true
+}
+
+// pruneSessions drops idle sessions, at most once a minute
+func pruneSessions() {
+	sessionPruneMu.Lock()
+	if time.Since(lastSessionPrune) < time.Minute {
+		sessionPruneMu.Unlock()
+		return
+	}
+	lastSessionPrune = time.Now()
+	sessionPruneMu.Unlock()
+
+	models.PruneSessions(sessionMaxIdle)
+}
+
+// CurrentSessionID returns the server-side session ID of the request, or ""
+func CurrentSessionID(c echo.Context) string {
+	session, err := Session(c)
+	if err != nil {
+		return ""
+	}
+	sid, _ := session.Values["sid"].(string)
+	return sid
+}
+
+// RevokeSession ends one of handle's sessions
+func RevokeSession(handle, sid string) error {
+	record, err := models.GetSession(sid)
+	if err != nil || record.Handle != handle {
+		return fmt.Errorf("session not found")
+	}
+	log.Printf("Revoking session %s… for %s", sid[:8], handle)
+	return models.DeleteSession(sid)
+}
+
+// RevokeAllSessions ends every session of handle, on every device
+func RevokeAllSessions(handle string) error {
+	log.Println("Revoking all sessions for", handle)
+	return models.DeleteSessions(handle, "")
+}
+
+// sessionCookieMaxAge converts the cookie MaxAge to the server-side idle timeout
+func sessionCookieMaxAge(options *sessions.Options) time.Duration {
+	if options == nil || options.MaxAge <= 0 {
+		return sessionMaxIdle
+	}
+	return time.Duration(options.MaxAge) * time.Second
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SiweMessage is an EIP-4361 Sign-In with Ethereum message
+type SiweMessage struct {
+	Domain         string
+	Address        string // EIP-55 checksummed
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+}
+
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// String renders the message exactly as the wallet will display and sign it
+func (m *SiweMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeader + "\n")
+	b.WriteString(m.Address + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "URI: %s\n", m.URI)
+	fmt.Fprintf(&b, "Version: %s\n", m.Version)
+	fmt.Fprintf(&b, "Chain ID: %d\n", m.ChainID)
+	fmt.Fprintf(&b, "Nonce: %s\n", m.Nonce)
+	fmt.Fprintf(&b, "Issued At: %s", m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		fmt.Fprintf(&b, "\nExpiration Time: %s", m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// ParseSiweMessage parses a message produced by SiweMessage.String. Parsing is strict:
+// the message must re-serialize to exactly the same text, so what was signed is what we check.
+func ParseSiweMessage(message string) (*SiweMessage, error) {
+	lines := strings.Split(message, "\n")
+	if len(lines) < 9 {
+		return nil, fmt.Errorf("siwe message too short")
+	}
+
+	m := &SiweMessage{}
+	domain, ok := strings.CutSuffix(lines[0], siweHeader)
+	if !ok || domain == "" {
+		return nil, fmt.Errorf("invalid siwe header")
+	}
+	m.Domain = domain
+	m.Address = lines[1]
+	if lines[2] != "" {
+		return nil, fmt.Errorf("invalid siwe message: expected blank line after address")
+	}
+
+	// optional statement followed by a blank line
+	i := 3
+	if lines[i] != "" {
+		m.Statement = lines[i]
+		i++
+	}
+	if lines[i] != "" {
+		return nil, fmt.Errorf("invalid siwe message: expected blank line after statement")
+	}
+	i++
+
+	fields := make(map[string]string)
+	for _, line := range lines[i:] {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid siwe field %q", line)
+		}
+		fields[key] = value
+	}
+
+	m.URI = fields["URI"]
+	m.Version = fields["Version"]
+	m.Nonce = fields["Nonce"]
+
+	chainID, err := strconv.ParseInt(fields["Chain ID"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid siwe chain id: %w", err)
+	}
+	m.ChainID = chainID
+
+	if m.IssuedAt, err = time.Parse(time.RFC3339, fields["Issued At"]); err != nil {
+		return nil, fmt.Errorf("invalid siwe issued at: %w", err)
+	}
+	if expiration, ok := fields["Expiration Time"]; ok {
+		if m.ExpirationTime, err = time.Parse(time.RFC3339, expiration); err != nil {
+			return nil, fmt.Errorf("invalid siwe expiration time: %w", err)
+		}
+	}
+
+	if m.String() != message {
+		return nil, fmt.Errorf("siwe message is not in canonical form")
+	}
+	return m, nil
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	models "dreamfriday/models"
+	utils "dreamfriday/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// API token scopes
+const (
+	ScopeReadPreview  = "read-preview"
+	ScopeWritePreview = "write-preview"
+	ScopePublish      = "publish"
+)
+
+var validScopes = map[string]bool{
+	ScopeReadPreview:  true,
+	ScopeWritePreview: true,
+	ScopePublish:      true,
+}
+
+// tokens are recognisable in logs and secret scanners by their prefix
+const tokenPrefix = "dft_"
+
+// how stale a token's LastUsed can get before a request records it again. Scripts make bursts
+// of calls, so this is coarser than sessionTouchInterval to keep writes down.
+const tokenTouchInterval = 5 * time.Minute
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken creates an API token for handle, limited to sites and scopes. A zero ttl never expires.
+// The returned string is the only copy of the token; only its hash is stored.
+func IssueToken(handle, name string, sites, scopes []string, ttl time.Duration) (string, *models.APIToken, error) {
+	if len(sites) == 0 {
+		return "", nil, fmt.Errorf("at least one site is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	rand.Read(id)
+	token := tokenPrefix + hex.EncodeToString(secret)
+
+	record := &models.APIToken{
+		ID:        hex.EncodeToString(id),
+		Hash:      hashToken(token),
+		Handle:    handle,
+		Name:      name,
+		Sites:     sites,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		record.ExpiresAt = record.CreatedAt.Add(ttl)
+	}
+	if err := models.SaveAPIToken(record); err != nil {
+		return "", nil, fmt.Errorf("failed to save token: %w", err)
+	}
+	log.Printf("Issued API token %s (%s) for %s", record.ID, name, handle)
+	return token, record, nil
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(c echo.Context) (string, bool) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// authenticateToken checks a bearer token is live and allows scope on site
+func authenticateToken(token, site, scope string) (*models.APIToken, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, fmt.Errorf("invalid token")
+	}
+	record, err := models.GetAPITokenByHash(hashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if !record.ExpiresAt.IsZero() && time.Now().After(record.ExpiresAt) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if !contains(record.Scopes, scope) {
+		return nil, fmt.Errorf("token does not allow %s", scope)
+	}
+	if !contains(record.Sites, site) {
+		return nil, fmt.Errorf("token does not allow site %s", site)
+	}
+	if time.Since(record.LastUsed) > tokenTouchInterval {
+		record.LastUsed = time.Now()
+		if err := models.SaveAPIToken(record); err != nil {
+			log.Println("Failed to update token:", err)
+		}
+	}
+	return record, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope allows a logged in session, or a bearer token scoped to scope and the request's site.
+// A token's owner becomes the request's handle (see GetHandle).
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token, ok := bearerToken(c); ok {
+				site := utils.GetSubdomain(c.Request().Host)
+				record, err := authenticateToken(token, site, scope)
+				if err != nil {
+					log.Printf("Rejected API token for %s %s: %v", c.Request().Method, c.Path(), err)
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+				}
+				c.Set("handle", record.Handle)
+				c.Set("apiToken", record)
+				return next(c)
+			}
+			return AuthMiddleware(next)(c)
+		}
+	}
+}
+
+// wantsJSON reports whether a request is an API call rather than a browser navigation
+func wantsJSON(c echo.Context) bool {
+	req := c.Request()
+	if req.Header.Get(echo.HeaderAuthorization) != "" || req.Method != http.MethodGet {
+		return true
+	}
+	return !strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
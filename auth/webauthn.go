@@ -0,0 +1,547 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	models "dreamfriday/models"
+	"dreamfriday/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WebAuthnConfig configures the relying party passkeys are registered to
+type WebAuthnConfig struct {
+	RPID    string // passkeys are scoped to this domain
+	RPName  string
+	Origins []string // exact origins ceremonies may come from, https://<RPID> unless configured
+}
+
+// WebAuthnConfigFromEnv reads WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME and WEBAUTHN_ORIGINS
+func WebAuthnConfigFromEnv() WebAuthnConfig {
+	config := WebAuthnConfig{
+		RPID:   os.Getenv("WEBAUTHN_RP_ID"),
+		RPName: os.Getenv("WEBAUTHN_RP_NAME"),
+	}
+	if config.RPID == "" {
+		config.RPID = utils.BaseDomain
+	}
+	if config.RPName == "" {
+		config.RPName = "Dream Friday"
+	}
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.Origins = append(config.Origins, origin)
+		}
+	}
+	if len(config.Origins) == 0 {
+		config.Origins = []string{"https://" + config.RPID}
+	}
+	return config
+}
+
+// WebAuthnAuthenticator logs users in with passkeys
+type WebAuthnAuthenticator struct {
+	config WebAuthnConfig
+}
+
+const webauthnTimeout = 5 * time.Minute
+
+// COSE algorithm identifiers we accept
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+// authenticator data flags
+const (
+	flagUserPresent   = 0x01
+	flagAttestedCreds = 0x40
+)
+
+func NewWebAuthnAuthenticator(config WebAuthnConfig) *WebAuthnAuthenticator {
+	return &WebAuthnAuthenticator{config: config}
+}
+
+// credentialResponse is a PublicKeyCredential serialized by the browser, with binary fields base64url encoded
+type credentialResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte // COSE key, only present during registration
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// beginCeremony issues a single-use challenge for user and binds it to the session
+func (a *WebAuthnAuthenticator) beginCeremony(c echo.Context, user string) (string, error) {
+	random := make([]byte, 32)
+	rand.Read(random)
+	challenge := base64.RawURLEncoding.EncodeToString(random)
+
+	if err := issueNonce(challenge, user, time.Now().Add(webauthnTimeout)); err != nil {
+		return "", err
+	}
+	session, err := Session(c)
+	if err != nil {
+		return "", err
+	}
+	session.Values["webauthnChallenge"] = challenge
+	if err := session.Save(c.Request(), c.Response()); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// BeginRegistration returns options for navigator.credentials.create. Logged in users
+// add a passkey to their account; anyone else gets a new passkey-only account.
+func (a *WebAuthnAuthenticator) BeginRegistration(c echo.Context) error {
+	handle, err := GetHandle(c)
+	loggedIn := ""
+	existing := []map[string]string{}
+	if err == nil {
+		loggedIn = handle
+		if user, err := models.GetUser(handle); err == nil {
+			for _, passkey := range user.Passkeys {
+				existing = append(existing, map[string]string{"type": "public-key", "id": passkey.ID})
+			}
+		}
+	} else {
+		random := make([]byte, 16)
+		rand.Read(random)
+		handle = "passkey:" + hex.EncodeToString(random)
+	}
+
+	// who was logged in when the ceremony started, beginCeremony saves it with the challenge
+	session, err := Session(c)
+	if err != nil {
+		log.Println("Failed to start passkey registration:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start registration"})
+	}
+	session.Values["webauthnHandle"] = loggedIn
+
+	challenge, err := a.beginCeremony(c, handle)
+	if err != nil {
+		log.Println("Failed to start passkey registration:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start registration"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"publicKey": map[string]interface{}{
+			"challenge": challenge,
+			"rp":        map[string]string{"id": a.config.RPID, "name": a.config.RPName},
+			"user": map[string]string{
+				"id":          base64.RawURLEncoding.EncodeToString([]byte(handle)),
+				"name":        handle,
+				"displayName": handle,
+			},
+			"pubKeyCredParams": []map[string]interface{}{
+				{"type": "public-key", "alg": coseES256},
+				{"type": "public-key", "alg": coseEdDSA},
+				{"type": "public-key", "alg": coseRS256},
+			},
+			"timeout":            webauthnTimeout.Milliseconds(),
+			"attestation":        "none",
+			"excludeCredentials": existing,
+			"authenticatorSelection": map[string]string{
+				"residentKey":      "required",
+				"userVerification": "preferred",
+			},
+		},
+	})
+}
+
+// FinishRegistration verifies a new credential and stores it on the user
+func (a *WebAuthnAuthenticator) FinishRegistration(c echo.Context) error {
+	var credential credentialResponse
+	if err := c.Bind(&credential); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	_, issued, err := a.verifyClientData(c, credential.Response.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		log.Println("Rejected passkey registration:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+
+	// whoever was logged in when the ceremony started, or nobody, must still be: after a logout,
+	// an expired session or another login the passkey would go to the wrong account
+	handle := issued.Address
+	session, _ := Session(c)
+	started, ok := session.Values["webauthnHandle"].(string)
+	delete(session.Values, "webauthnHandle")
+	current, err := GetHandle(c)
+	if err != nil {
+		current = ""
+	}
+	if !ok || current != started || (started != "" && started != handle) {
+		log.Printf("Rejected passkey registration for %s: started as %q, now %q", handle, started, current)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session changed during registration"})
+	}
+
+	passkey, err := a.verifyAttestation(credential)
+	if err != nil {
+		log.Println("Rejected passkey registration:", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := models.AddPasskey(handle, *passkey); err != nil {
+		log.Println("Failed to save passkey:", err)
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err := storeHandle(c, "webauthn", handle); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store session"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "registered", "handle": handle})
+}
+
+// verifyAttestation checks a registration response's authenticator data and extracts the credential.
+// We request "none" attestation, so the attestation statement itself is not verified.
+func (a *WebAuthnAuthenticator) verifyAttestation(credential credentialResponse) (*models.Passkey, error) {
+	attestationObject, err := decodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object encoding")
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	object, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation object has no authData")
+	}
+
+	authData, err := a.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&flagAttestedCreds == 0 {
+		return nil, fmt.Errorf("no attested credential data")
+	}
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, fmt.Errorf("credential ID mismatch")
+	}
+	if _, _, err := parseCOSEKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &models.Passkey{
+		ID:        base64.RawURLEncoding.EncodeToString(authData.CredentialID),
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Login returns options for navigator.credentials.get (to match interface)
+func (a *WebAuthnAuthenticator) Login(c echo.Context, _, _ string) error {
+	return a.BeginLogin(c)
+}
+
+// BeginLogin returns options for a discoverable credential assertion
+func (a *WebAuthnAuthenticator) BeginLogin(c echo.Context) error {
+	challenge, err := a.beginCeremony(c, "")
+	if err != nil {
+		log.Println("Failed to start passkey login:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start login"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"publicKey": map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             a.config.RPID,
+			"timeout":          webauthnTimeout.Milliseconds(),
+			"userVerification": "preferred",
+		},
+	})
+}
+
+// FinishLogin verifies an assertion against the stored credential and logs in its user
+func (a *WebAuthnAuthenticator) FinishLogin(c echo.Context) error {
+	var credential credentialResponse
+	if err := c.Bind(&credential); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	clientDataJSON, _, err := a.verifyClientData(c, credential.Response.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		log.Println("Rejected passkey login:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid credential ID"})
+	}
+	id := base64.RawURLEncoding.EncodeToString(rawID)
+	user, passkey, err := models.FindPasskey(id)
+	if err != nil {
+		log.Println("Rejected passkey login:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unknown passkey"})
+	}
+
+	if credential.Response.UserHandle != "" {
+		userHandle, err := decodeBase64URL(credential.Response.UserHandle)
+		if err != nil || string(userHandle) != user.Address {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Passkey belongs to another user"})
+		}
+	}
+
+	signCount, err := a.verifyAssertion(credential, clientDataJSON, passkey)
+	if err != nil {
+		log.Println("Rejected passkey login:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	if err := models.TouchPasskey(id, signCount); err != nil {
+		log.Println("Failed to update passkey:", err)
+	}
+
+	handle, err := completeLogin(c, "webauthn", id, user.Address)
+	if err != nil {
+		log.Println("Error storing session:", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "authenticated", "handle": handle})
+}
+
+// verifyAssertion checks an assertion signature and returns the authenticator's new signature counter
+func (a *WebAuthnAuthenticator) verifyAssertion(credential credentialResponse, clientDataJSON []byte, passkey *models.Passkey) (uint32, error) {
+	rawAuthData, err := decodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("invalid authenticator data encoding")
+	}
+	authData, err := a.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := decodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("invalid signature encoding")
+	}
+
+	publicKey, alg, err := parseCOSEKey(passkey.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !verifyCOSESignature(publicKey, alg, signed, signature) {
+		return 0, fmt.Errorf("signature verification failed")
+	}
+
+	// a counter that doesn't move forward means the credential may have been cloned
+	if (authData.SignCount != 0 || passkey.SignCount != 0) && authData.SignCount <= passkey.SignCount {
+		return 0, fmt.Errorf("signature counter did not increase")
+	}
+	return authData.SignCount, nil
+}
+
+// verifyClientData checks the ceremony type, the origin, and that the challenge is the
+// one issued to this session and hasn't been used
+func (a *WebAuthnAuthenticator) verifyClientData(c echo.Context, encoded, ceremony string) ([]byte, *issuedNonce, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client data encoding")
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, fmt.Errorf("invalid client data")
+	}
+	if data.Type != ceremony {
+		return nil, nil, fmt.Errorf("unexpected ceremony %q", data.Type)
+	}
+	if !a.allowedOrigin(data.Origin) {
+		return nil, nil, fmt.Errorf("origin %s not allowed", data.Origin)
+	}
+
+	session, err := Session(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve session")
+	}
+	expected, _ := session.Values["webauthnChallenge"].(string)
+	delete(session.Values, "webauthnChallenge")
+	if expected == "" || data.Challenge != expected {
+		return nil, nil, fmt.Errorf("challenge was not issued to this session")
+	}
+	issued, err := takeNonce(data.Challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, issued, nil
+}
+
+// allowedOrigin accepts only the configured origins. Any subdomain of the RP ID could otherwise
+// run a ceremony, and sites' subdomains serve content their owners write.
+func (a *WebAuthnAuthenticator) allowedOrigin(origin string) bool {
+	for _, allowed := range a.config.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAuthenticatorData decodes authenticator data and checks the RP ID hash and user presence
+func (a *WebAuthnAuthenticator) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+	data := &authenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(a.config.RPID))
+	if !bytes.Equal(data.RPIDHash, rpIDHash[:]) {
+		return nil, fmt.Errorf("credential is for another relying party")
+	}
+	if data.Flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("user was not present")
+	}
+
+	if data.Flags&flagAttestedCreds != 0 {
+		// aaguid (16) | credential ID length (2) | credential ID | COSE public key
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("attested credential data too short")
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, fmt.Errorf("credential ID exceeds authenticator data")
+		}
+		data.CredentialID = rest[:idLength]
+		_, keyLength, err := decodeCBOR(rest[idLength:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		data.PublicKey = rest[idLength : idLength+keyLength]
+	}
+	return data, nil
+}
+
+// parseCOSEKey decodes an ES256, EdDSA (Ed25519) or RS256 COSE key
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid COSE key: %w", err)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid COSE key")
+	}
+	alg, _ := key[int64(3)].(int64)
+
+	switch alg {
+	case coseES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, fmt.Errorf("invalid P-256 key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, fmt.Errorf("P-256 key is not on the curve")
+		}
+		return publicKey, alg, nil
+	case coseEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case coseRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, fmt.Errorf("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported COSE algorithm %d", alg)
+	}
+}
+
+func verifyCOSESignature(publicKey crypto.PublicKey, alg int64, signed, signature []byte) bool {
+	switch alg {
+	case coseES256:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature)
+	case coseEdDSA:
+		return ed25519.Verify(publicKey.(ed25519.PublicKey), signed, signature)
+	case coseRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+// Register requires a browser ceremony, use BeginRegistration
+func (a *WebAuthnAuthenticator) Register(_, _ string) error {
+	return fmt.Errorf("passkeys are registered from the browser at /auth/webauthn/register/begin")
+}
+
+func (a *WebAuthnAuthenticator) PasswordReset(_ string) error {
+	log.Println("Passkeys have no password to reset.")
+	return nil
+}
+
+// StoreSession stores the authenticated handle in a session
+func (a *WebAuthnAuthenticator) StoreSession(c echo.Context, _, handle string) error {
+	return storeHandle(c, "webauthn", handle)
+}
+
+// ValidateSession for passkey authentication
+func (a *WebAuthnAuthenticator) ValidateSession(token string) bool {
+	return activeSession(token, "")
+}
+
+// Logout clears the session for passkey users
+func (a *WebAuthnAuthenticator) Logout(c echo.Context) error {
+	return clearSession(c)
+}
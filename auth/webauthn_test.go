@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	models "dreamfriday/models"
+)
+
+func TestPasskeyRegistrationSession(t *testing.T) {
+	authenticator := NewWebAuthnAuthenticator(WebAuthnConfig{RPID: "example.com", Origins: []string{"https://example.com"}})
+	login := func(b *browser, subject string) {
+		c, rec := b.request(http.MethodGet, "/", "")
+		if _, err := completeLogin(c, "oidc", subject, "oidc:"+subject); err != nil {
+			t.Fatal(err)
+		}
+		b.done(rec)
+	}
+	expire := func(b *browser) {
+		c, _ := b.request(http.MethodGet, "/", "")
+		session, _ := Session(c)
+		models.DeleteSession(session.Values["sid"].(string))
+	}
+
+	tests := []struct {
+		name    string
+		before  func(b *browser) // before registration starts
+		between func(b *browser) // while the authenticator creates the passkey
+		changed bool
+	}{
+		{name: "logged in throughout", before: func(b *browser) { login(b, "alice") }},
+		{name: "anonymous throughout"},
+		{name: "session expired", before: func(b *browser) { login(b, "alice") }, between: expire, changed: true},
+		{name: "someone else logged in", before: func(b *browser) { login(b, "alice") }, between: func(b *browser) { login(b, "bob") }, changed: true},
+		{name: "logged in during an anonymous registration", between: func(b *browser) { login(b, "bob") }, changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBrowser()
+			if tt.before != nil {
+				tt.before(b)
+			}
+			c, rec := b.request(http.MethodPost, "/auth/webauthn/register/begin", "")
+			if err := authenticator.BeginRegistration(c); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("begin: %v, status %d", err, rec.Code)
+			}
+			b.done(rec)
+			var options struct {
+				PublicKey struct {
+					Challenge string `json:"challenge"`
+				} `json:"publicKey"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &options)
+			if tt.between != nil {
+				tt.between(b)
+			}
+
+			clientData, _ := json.Marshal(clientData{Type: "webauthn.create", Challenge: options.PublicKey.Challenge, Origin: "https://example.com"})
+			var credential credentialResponse
+			credential.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientData)
+			body, _ := json.Marshal(credential)
+			c, rec = b.request(http.MethodPost, "/auth/webauthn/register/finish", string(body))
+			authenticator.FinishRegistration(c)
+
+			// without an attestation the registration fails anyway, after the session check
+			changed := rec.Code == http.StatusUnauthorized && strings.Contains(rec.Body.String(), "Session changed")
+			if changed != tt.changed {
+				t.Fatalf("finish answered %d %s, want session changed: %v", rec.Code, rec.Body, tt.changed)
+			}
+		})
+	}
+}
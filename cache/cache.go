@@ -1,14 +1,69 @@
 package cache
 
+import "time"
+
 type Cache interface {
 	Set(key string, value interface{})
+	SetWithTTL(key string, value interface{}, ttl time.Duration)
 	Get(key string) (interface{}, bool)
 	Delete(key string)
+	Stats() Stats
+}
+
+// Stats reports the current size of a cache and its lifetime counters
+type Stats struct {
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// Options bound how much a cache may hold and for how long
+type Options struct {
+	TTL        time.Duration                 // default time to live, 0 never expires
+	MaxEntries int                           // evict least recently used entries above this count, 0 is unbounded
+	MaxBytes   int64                         // evict least recently used entries above this size, 0 is unbounded
+	SizeOf     func(value interface{}) int64 // estimates the size of entries that aren't Sized, defaults to their JSON encoded length
+}
+
+// Sized is implemented by values that know their encoded size, so storing them in a
+// byte bounded cache doesn't encode them again just to measure them
+type Sized interface {
+	CacheSize() int64 // size in bytes, 0 if unknown
 }
 
+var siteDataOptions = Options{MaxEntries: 1000, MaxBytes: 256 << 20}
+
+// sessions last 3 hours, so there is no point holding per-handle data longer
+var previewOptions = Options{TTL: 3 * time.Hour, MaxEntries: 1000, MaxBytes: 256 << 20}
+var userDataOptions = Options{TTL: 3 * time.Hour, MaxEntries: 10000}
+
+// rendered pages are keyed by CID, but external imports can still change underneath them
+var renderOptions = Options{TTL: 10 * time.Minute, MaxEntries: 5000, MaxBytes: 64 << 20}
+
+// rendered markdown is keyed by content hash, so it never goes stale
+var markdownOptions = Options{MaxEntries: 10000, MaxBytes: 32 << 20}
+
 /* public */
-var SiteDataStore Cache = NewMemoryCache()
+var SiteDataStore Cache = NewMemoryCache(siteDataOptions)
+var RenderCache Cache = NewMemoryCache(renderOptions)
 
 /* private */
-var PreviewCache Cache = NewMemoryCache()
-var UserDataStore Cache = NewMemoryCache()
+var PreviewCache Cache = NewMemoryCache(previewOptions)
+var UserDataStore Cache = NewMemoryCache(userDataOptions)
+
+/* local, cheap to render again on each instance */
+var MarkdownCache Cache = NewMemoryCache(markdownOptions)
+
+// AllStats returns the stats of every cache by name
+func AllStats() map[string]Stats {
+	return map[string]Stats{
+		"siteData": SiteDataStore.Stats(),
+		"preview":  PreviewCache.Stats(),
+		"userData": UserDataStore.Stats(),
+		"render":   RenderCache.Stats(),
+		"markdown": MarkdownCache.Stats(),
+	}
+}
@@ -1,24 +1,170 @@
 package cache
 
-import "sync"
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
 
-// MemoryCache implements Cache using sync.Map
+// MemoryCache implements Cache as a size-bounded LRU with optional per-entry TTL
 type MemoryCache struct {
-	store sync.Map
+	mu      sync.Mutex
+	options Options
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+	bytes   int64
+	stats   Stats
 }
 
-func NewMemoryCache() *MemoryCache {
-	return &MemoryCache{}
+type memoryEntry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time // zero never expires
+}
+
+func NewMemoryCache(options Options) *MemoryCache {
+	if options.SizeOf == nil {
+		options.SizeOf = jsonSize
+	}
+	c := &MemoryCache{
+		options: options,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if options.TTL > 0 {
+		go c.janitor(time.Minute)
+	}
+	return c
+}
+
+// sizeOf measures a value for MaxBytes, trusting values that report their own size
+func (c *MemoryCache) sizeOf(value interface{}) int64 {
+	if sized, ok := value.(Sized); ok {
+		if size := sized.CacheSize(); size > 0 {
+			return size
+		}
+	}
+	return c.options.SizeOf(value)
+}
+
+// jsonSize estimates the memory held by a value from its JSON encoding
+func jsonSize(value interface{}) int64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
 }
 
 func (c *MemoryCache) Set(key string, value interface{}) {
-	c.store.Store(key, value)
+	c.SetWithTTL(key, value, c.options.TTL)
+}
+
+func (c *MemoryCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	var size int64
+	if c.options.MaxBytes > 0 {
+		size = c.sizeOf(value)
+	}
+	c.set(key, value, size, ttl)
+}
+
+// set stores a value whose size is already known, e.g. from the bytes it was encoded to
+func (c *MemoryCache) set(key string, value interface{}, size int64, ttl time.Duration) {
+	entry := &memoryEntry{key: key, value: value, size: size}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+
+	// evict least recently used entries until we're back within bounds, but always keep the new entry
+	for c.lru.Len() > 1 && c.overLimit() {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *MemoryCache) overLimit() bool {
+	if c.options.MaxEntries > 0 && c.lru.Len() > c.options.MaxEntries {
+		return true
+	}
+	return c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes
 }
 
 func (c *MemoryCache) Get(key string) (interface{}, bool) {
-	return c.store.Load(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if entry.expired(time.Now()) {
+		c.remove(elem)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	return entry.value, true
 }
 
 func (c *MemoryCache) Delete(key string) {
-	c.store.Delete(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *MemoryCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func (c *MemoryCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memoryEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// janitor periodically drops expired entries so they don't linger until evicted
+func (c *MemoryCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		c.mu.Lock()
+		for elem := c.lru.Back(); elem != nil; {
+			prev := elem.Prev()
+			if elem.Value.(*memoryEntry).expired(now) {
+				c.remove(elem)
+				c.stats.Expirations++
+			}
+			elem = prev
+		}
+		c.mu.Unlock()
+	}
 }
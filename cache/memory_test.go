@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	sizeOfString := func(value interface{}) int64 { return int64(len(value.(string))) }
+
+	tests := []struct {
+		name          string
+		options       Options
+		sets          []string // keys, each set to its own name as value
+		gets          []string // read after all sets, refreshing recency
+		more          []string // set after the reads
+		wantKept      []string
+		wantEvicted   []string
+		wantEvictions uint64
+	}{
+		{
+			name:          "entries bound drops the least recently set",
+			options:       Options{MaxEntries: 2},
+			sets:          []string{"a", "b", "c"},
+			wantKept:      []string{"b", "c"},
+			wantEvicted:   []string{"a"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "reads refresh recency",
+			options:       Options{MaxEntries: 2},
+			sets:          []string{"a", "b"},
+			gets:          []string{"a"},
+			more:          []string{"c"},
+			wantKept:      []string{"a", "c"},
+			wantEvicted:   []string{"b"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "bytes bound",
+			options:       Options{MaxBytes: 5, SizeOf: sizeOfString},
+			sets:          []string{"aa", "bb", "cc"},
+			wantKept:      []string{"bb", "cc"},
+			wantEvicted:   []string{"aa"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "an entry larger than the bound is still kept",
+			options:       Options{MaxBytes: 2, SizeOf: sizeOfString},
+			sets:          []string{"a", "large"},
+			wantKept:      []string{"large"},
+			wantEvicted:   []string{"a"},
+			wantEvictions: 1,
+		},
+		{
+			name:     "unbounded",
+			options:  Options{},
+			sets:     []string{"a", "b", "c"},
+			wantKept: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(tt.options)
+			for _, key := range tt.sets {
+				c.Set(key, key)
+			}
+			for _, key := range tt.gets {
+				c.Get(key)
+			}
+			for _, key := range tt.more {
+				c.Set(key, key)
+			}
+			evictions := c.Stats().Evictions
+			for _, key := range tt.wantKept {
+				if value, found := c.Get(key); !found || value != key {
+					t.Errorf("%s = %v, %v, want it kept", key, value, found)
+				}
+			}
+			for _, key := range tt.wantEvicted {
+				if _, found := c.Get(key); found {
+					t.Errorf("%s was kept, want it evicted", key)
+				}
+			}
+			if evictions != tt.wantEvictions {
+				t.Errorf("evictions = %d, want %d", evictions, tt.wantEvictions)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	c := NewMemoryCache(Options{})
+	c.SetWithTTL("short", "v", 10*time.Millisecond)
+	c.Set("forever", "v")
+	time.Sleep(20 * time.Millisecond)
+
+	if _, found := c.Get("short"); found {
+		t.Error("expired entry was returned")
+	}
+	if _, found := c.Get("forever"); !found {
+		t.Error("entry without a ttl expired")
+	}
+	stats := c.Stats()
+	want := Stats{Entries: 1, Hits: 1, Misses: 1, Expirations: 1}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestMemoryCacheReplaceAndDelete(t *testing.T) {
+	c := NewMemoryCache(Options{MaxBytes: 100, SizeOf: func(value interface{}) int64 { return int64(len(value.(string))) }})
+	c.Set("k", "four")
+	c.Set("k", "sixsix")
+	if stats := c.Stats(); stats.Entries != 1 || stats.Bytes != 6 {
+		t.Errorf("after replace stats = %+v, want 1 entry of 6 bytes", stats)
+	}
+	c.Delete("k")
+	c.Delete("missing")
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("after delete stats = %+v, want empty", stats)
+	}
+}
+
+// sizedValue reports its own size, like values loaded from JSON that kept its length
+type sizedValue struct{ size int64 }
+
+func (v sizedValue) CacheSize() int64 { return v.size }
+
+func TestMemoryCacheSizedValues(t *testing.T) {
+	measured := 0
+	c := NewMemoryCache(Options{MaxBytes: 100, SizeOf: func(value interface{}) int64 {
+		measured++
+		return 7
+	}})
+	c.Set("sized", sizedValue{size: 40})
+	if stats := c.Stats(); stats.Bytes != 40 || measured != 0 {
+		t.Errorf("stats = %+v after %d SizeOf calls, want 40 bytes without measuring", stats, measured)
+	}
+	// a value that doesn't know its size is measured as usual
+	c.Set("unknown", sizedValue{})
+	if stats := c.Stats(); stats.Bytes != 47 || measured != 1 {
+		t.Errorf("stats = %+v after %d SizeOf calls, want 47 bytes after one", stats, measured)
+	}
+}
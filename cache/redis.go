@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// InvalidationChannel is the pub/sub channel used to tell other instances to drop local copies
+const InvalidationChannel = "dreamfriday:invalidate"
+
+// Codec converts cached values to and from bytes for a shared backend
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// RedisCache implements Cache on a Redis protocol server shared by every instance.
+// Values are also kept in a short lived local cache that is invalidated over pub/sub
+// whenever any instance sets or deletes a key.
+type RedisCache struct {
+	name    string
+	client  *RedisClient
+	codec   Codec
+	ttl     time.Duration
+	local   *MemoryCache
+	bus     *invalidationBus
+	mu      sync.Mutex
+	counter Stats
+}
+
+type invalidation struct {
+	From  string `json:"from"`
+	Cache string `json:"cache"`
+	Key   string `json:"key"`
+}
+
+// invalidationBus fans invalidation messages out to the RedisCaches of this instance
+type invalidationBus struct {
+	id     string
+	client *RedisClient
+	mu     sync.RWMutex
+	caches map[string]*RedisCache
+}
+
+func newInvalidationBus(client *RedisClient) *invalidationBus {
+	id := make([]byte, 8)
+	rand.Read(id)
+	bus := &invalidationBus{
+		id:     hex.EncodeToString(id),
+		client: client,
+		caches: make(map[string]*RedisCache),
+	}
+	client.Subscribe(InvalidationChannel, bus.receive, make(chan struct{}))
+	return bus
+}
+
+func (b *invalidationBus) publish(cache, key string) {
+	message, _ := json.Marshal(invalidation{From: b.id, Cache: cache, Key: key})
+	if _, err := b.client.Do("PUBLISH", InvalidationChannel, string(message)); err != nil {
+		log.Printf("Failed to publish invalidation for %s/%s: %v", cache, key, err)
+	}
+}
+
+func (b *invalidationBus) receive(message string) {
+	var msg invalidation
+	if err := json.Unmarshal([]byte(message), &msg); err != nil {
+		log.Println("Ignoring malformed invalidation:", err)
+		return
+	}
+	if msg.From == b.id {
+		return
+	}
+	b.mu.RLock()
+	c, ok := b.caches[msg.Cache]
+	b.mu.RUnlock()
+	if ok {
+		c.local.Delete(msg.Key)
+	}
+}
+
+// newRedisCache creates a shared cache whose keys are namespaced by name
+func newRedisCache(name string, client *RedisClient, bus *invalidationBus, codec Codec, options Options) *RedisCache {
+	// the local copy only has to survive until an invalidation could have been missed
+	localOptions := options
+	if localOptions.TTL == 0 || localOptions.TTL > time.Minute {
+		localOptions.TTL = time.Minute
+	}
+	c := &RedisCache{
+		name:   name,
+		client: client,
+		codec:  codec,
+		ttl:    options.TTL,
+		local:  NewMemoryCache(localOptions),
+		bus:    bus,
+	}
+	bus.mu.Lock()
+	bus.caches[name] = c
+	bus.mu.Unlock()
+	return c
+}
+
+func (c *RedisCache) key(key string) string {
+	return "dreamfriday:" + c.name + ":" + key
+}
+
+func (c *RedisCache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *RedisCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	localTTL := c.local.options.TTL
+	if ttl > 0 && ttl < time.Minute {
+		localTTL = ttl
+	}
+
+	// the encoding is the local copy's size, so it isn't measured a second time
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		log.Printf("Failed to encode %s/%s for redis: %v", c.name, key, err)
+		c.local.SetWithTTL(key, value, localTTL)
+		return
+	}
+	c.local.set(key, value, int64(len(data)), localTTL)
+	args := []string{"SET", c.key(key), string(data)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := c.client.Do(args...); err != nil {
+		log.Printf("Failed to set %s/%s in redis: %v", c.name, key, err)
+		return
+	}
+	c.bus.publish(c.name, key)
+}
+
+func (c *RedisCache) Get(key string) (interface{}, bool) {
+	if value, ok := c.local.Get(key); ok {
+		c.count(func(s *Stats) { s.Hits++ })
+		return value, true
+	}
+
+	reply, err := c.client.Do("GET", c.key(key))
+	if err != nil {
+		if !errors.Is(err, errNil) {
+			log.Printf("Failed to get %s/%s from redis: %v", c.name, key, err)
+		}
+		c.count(func(s *Stats) { s.Misses++ })
+		return nil, false
+	}
+	data, ok := reply.(string)
+	if !ok {
+		c.count(func(s *Stats) { s.Misses++ })
+		return nil, false
+	}
+	value, err := c.codec.Decode([]byte(data))
+	if err != nil {
+		log.Printf("Failed to decode %s/%s from redis: %v", c.name, key, err)
+		c.count(func(s *Stats) { s.Misses++ })
+		return nil, false
+	}
+
+	c.local.set(key, value, int64(len(data)), c.local.options.TTL)
+	c.count(func(s *Stats) { s.Hits++ })
+	return value, true
+}
+
+func (c *RedisCache) Delete(key string) {
+	c.local.Delete(key)
+	if _, err := c.client.Do("DEL", c.key(key)); err != nil {
+		log.Printf("Failed to delete %s/%s from redis: %v", c.name, key, err)
+	}
+	c.bus.publish(c.name, key)
+}
+
+// Stats reports shared hits and misses seen by this instance. Entries, bytes and
+// evictions describe the local copy; the server applies its own eviction policy.
+func (c *RedisCache) Stats() Stats {
+	local := c.local.Stats()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counter
+	stats.Entries = local.Entries
+	stats.Bytes = local.Bytes
+	stats.Evictions = local.Evictions
+	stats.Expirations = local.Expirations
+	return stats
+}
+
+func (c *RedisCache) count(fn func(s *Stats)) {
+	c.mu.Lock()
+	fn(&c.counter)
+	c.mu.Unlock()
+}
+
+// UseRedis replaces the process local caches with caches shared through a Redis
+// protocol server. codecs must contain an entry for every cache named in AllStats.
+func UseRedis(rawURL string, codecs map[string]Codec) error {
+	client, err := NewRedisClient(rawURL)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do("PING"); err != nil {
+		return fmt.Errorf("failed to reach redis at %s: %w", client.addr, err)
+	}
+	for _, name := range []string{"siteData", "preview", "userData", "render"} {
+		if codecs[name] == nil {
+			return fmt.Errorf("no codec for cache %q", name)
+		}
+	}
+
+	bus := newInvalidationBus(client)
+	SiteDataStore = newRedisCache("siteData", client, bus, codecs["siteData"], siteDataOptions)
+	PreviewCache = newRedisCache("preview", client, bus, codecs["preview"], previewOptions)
+	UserDataStore = newRedisCache("userData", client, bus, codecs["userData"], userDataOptions)
+	RenderCache = newRedisCache("render", client, bus, codecs["render"], renderOptions)
+
+	log.Println("Using shared redis cache at", client.addr)
+	return nil
+}
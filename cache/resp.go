@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNil is returned by RedisClient.Do when the server replies with a null bulk string
+var errNil = errors.New("redis: nil")
+
+// connections kept open between commands, unless the URL sets pool_size
+const defaultPoolSize = 10
+
+// RedisClient is a minimal client for servers speaking the Redis protocol (RESP2)
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	poolSize int // most idle connections kept, extra ones are closed
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisClient parses a redis://[:password@]host:port[/db][?pool_size=n] URL
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis scheme %q", u.Scheme)
+	}
+	client := &RedisClient{addr: u.Host, timeout: 5 * time.Second, poolSize: defaultPoolSize}
+	if u.User != nil {
+		client.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis db %q", db)
+		}
+	}
+	if size := u.Query().Get("pool_size"); size != "" {
+		if client.poolSize, err = strconv.Atoi(size); err != nil || client.poolSize < 1 {
+			return nil, fmt.Errorf("invalid redis pool_size %q", size)
+		}
+	}
+	return client, nil
+}
+
+func (r *RedisClient) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", r.addr, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if r.password != "" {
+		if _, err := rc.do(r.timeout, "AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := rc.do(r.timeout, "SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// Do sends a command and returns its reply: string, int64, []interface{} or nil
+func (r *RedisClient) Do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	var rc *redisConn
+	if n := len(r.idle); n > 0 {
+		rc, r.idle = r.idle[n-1], r.idle[:n-1]
+	}
+	r.mu.Unlock()
+
+	if rc == nil {
+		var err error
+		if rc, err = r.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := rc.do(r.timeout, args...)
+	var redisErr redisError
+	if err != nil && !errors.Is(err, errNil) && !errors.As(err, &redisErr) {
+		// the connection is in an unknown state, don't reuse it
+		rc.conn.Close()
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if len(r.idle) < r.poolSize {
+		r.idle = append(r.idle, rc)
+		rc = nil
+	}
+	r.mu.Unlock()
+	if rc != nil {
+		rc.conn.Close()
+	}
+	return reply, err
+}
+
+// Subscribe delivers every message published on channel to fn, reconnecting until stop is closed
+func (r *RedisClient) Subscribe(channel string, fn func(message string), stop <-chan struct{}) {
+	go func() {
+		backoff := time.Second
+		for {
+			err := r.subscribe(channel, fn, stop)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			log.Printf("Redis subscription to %s lost, retrying in %s: %v", channel, backoff, err)
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+	}()
+}
+
+func (r *RedisClient) subscribe(channel string, fn func(message string), stop <-chan struct{}) error {
+	rc, err := r.dial()
+	if err != nil {
+		return err
+	}
+	defer rc.conn.Close()
+
+	// unblock the read below on shutdown, without outliving this connection
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			rc.conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := rc.write("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := rc.read()
+		if err != nil {
+			return err
+		}
+		// pushed messages look like ["message", channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		if payload, ok := parts[2].(string); ok {
+			fn(payload)
+		}
+	}
+}
+
+func (rc *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(timeout))
+	defer rc.conn.SetDeadline(time.Time{})
+	if err := rc.write(args...); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+func (rc *redisConn) write(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(rc.conn, b.String())
+	return err
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := rc.read()
+			if err != nil && !errors.Is(err, errNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -15,6 +16,9 @@ var (
 	initOnce sync.Once // Ensures BoltDB is only initialized once
 )
 
+// ErrNotFound is returned, wrapped, when a key doesn't exist
+var ErrNotFound = errors.New("not found")
+
 type User struct {
 	Address string   `json:"address"`
 	Sites   []string `json:"sites"`
@@ -44,6 +48,24 @@ func BoltInit(path string) error {
 			if _, err := tx.CreateBucketIfNotExists([]byte("Sites")); err != nil {
 				return fmt.Errorf("create Sites bucket: %w", err)
 			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("SiteDataCache")); err != nil {
+				return fmt.Errorf("create SiteDataCache bucket: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("AuthNonces")); err != nil {
+				return fmt.Errorf("create AuthNonces bucket: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("Identities")); err != nil {
+				return fmt.Errorf("create Identities bucket: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("Sessions")); err != nil {
+				return fmt.Errorf("create Sessions bucket: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("APITokens")); err != nil {
+				return fmt.Errorf("create APITokens bucket: %w", err)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte("SiteVersions")); err != nil {
+				return fmt.Errorf("create SiteVersions bucket: %w", err)
+			}
 			return nil
 		})
 
@@ -92,7 +114,7 @@ func Get(bucket, key string, out interface{}) error {
 		data := bkt.Get([]byte(key))
 		if data == nil {
 			log.Println("key not found")
-			return fmt.Errorf("key %q not found", key)
+			return fmt.Errorf("key %q %w", key, ErrNotFound)
 		}
 		log.Println("key found")
 		return json.Unmarshal(data, out)
@@ -112,3 +134,127 @@ func Delete(bucket, key string) error {
 		return bkt.Delete([]byte(key))
 	})
 }
+
+// ForEach calls fn for every key/value pair in the given bucket.
+func ForEach(bucket string, fn func(key string, value []byte) error) error {
+	if boltDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return boltDB.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return fmt.Errorf("bucket %q not found", bucket)
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// Take atomically reads and removes a key, so only one caller can ever receive it.
+func Take(bucket, key string, out interface{}) error {
+	if boltDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return boltDB.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return fmt.Errorf("bucket %q not found", bucket)
+		}
+		data := bkt.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("key %q %w", key, ErrNotFound)
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return err
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+// DeleteWhere removes every key in the bucket for which match returns true.
+func DeleteWhere(bucket string, match func(key string, value []byte) bool) error {
+	if boltDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return boltDB.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return fmt.Errorf("bucket %q not found", bucket)
+		}
+		var keys [][]byte
+		err := bkt.ForEach(func(k, v []byte) error {
+			if match(string(k), v) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Tx is a read-write transaction spanning any number of buckets.
+type Tx struct {
+	tx *bbolt.Tx
+}
+
+func (t *Tx) bucket(name string) (*bbolt.Bucket, error) {
+	bkt := t.tx.Bucket([]byte(name))
+	if bkt == nil {
+		return nil, fmt.Errorf("bucket %q not found", name)
+	}
+	return bkt, nil
+}
+
+// Get reads a key inside the transaction.
+func (t *Tx) Get(bucket, key string, out interface{}) error {
+	bkt, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	data := bkt.Get([]byte(key))
+	if data == nil {
+		return fmt.Errorf("key %q %w", key, ErrNotFound)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Put writes a key inside the transaction.
+func (t *Tx) Put(bucket, key string, value interface{}) error {
+	bkt, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bkt.Put([]byte(key), data)
+}
+
+// Delete removes a key inside the transaction.
+func (t *Tx) Delete(bucket, key string) error {
+	bkt, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return bkt.Delete([]byte(key))
+}
+
+// Update runs fn in a single read-write transaction. If fn returns an error nothing is written.
+func Update(fn func(tx *Tx) error) error {
+	if boltDB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return boltDB.Update(func(tx *bbolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
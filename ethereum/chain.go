@@ -0,0 +1,49 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ChainReader reads contract state from a chain. *ethclient.Client and the
+// client of go-ethereum's simulated backend both implement it.
+type ChainReader interface {
+	geth.ContractCaller
+	geth.BlockNumberReader
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Reader is the chain reader used for on-chain lookups. It is nil when no RPC endpoint is configured.
+var Reader ChainReader
+
+// Init connects Reader to an RPC endpoint
+func Init(rpcURL string) error {
+	client, err := ethclient.Dial(rpcURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", rpcURL, err)
+	}
+	Reader = client
+	Writer = client
+	log.Println("Connected to chain RPC:", rpcURL)
+	return nil
+}
+
+// SetReader replaces Reader, e.g. with a simulated backend client
+func SetReader(reader ChainReader) {
+	Reader = reader
+}
+
+// IsContract reports whether an address has code deployed
+func IsContract(ctx context.Context, reader ChainReader, address common.Address) (bool, error) {
+	code, err := reader.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(code) > 0, nil
+}
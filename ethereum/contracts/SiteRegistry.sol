@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+// SiteRegistry records the IPFS CID each site publishes, so anyone can check
+// that a site is serving what its owner signed for. Creating or updating a
+// site costs a small fee, forwarded to the platform address.
+//
+// This file is the reference for the contract's interface and behaviour. The
+// deployed code is SiteRegistry.easm, which ethereum.SiteRegistryBin assembles
+// with go-ethereum's core/asm so the registry can be deployed without solc.
+contract SiteRegistry {
+    struct Site {
+        string ipfsCID;
+        address owner;
+    }
+
+    mapping(string => Site) private sites;
+
+    // The platform's address that receives fees.
+    address payable public platformAddress;
+
+    // Fee to create or update a site (0.001 of the native token)
+    uint256 public constant CREATION_FEE = 1000000000000000;
+
+    event SiteUpdated(string indexed name, string ipfsCID, address indexed owner);
+
+    constructor(address payable _platformAddress) {
+        platformAddress = _platformAddress;
+    }
+
+    // Create or update a site. The first caller to register a name owns it.
+    function setSite(string memory name, string memory ipfsCID) public payable {
+        require(msg.value >= CREATION_FEE, "Insufficient fee");
+        require(bytes(name).length > 0, "Site name cannot be empty");
+        require(bytes(ipfsCID).length > 0, "IPFS CID cannot be empty");
+
+        if (sites[name].owner == address(0)) {
+            sites[name] = Site(ipfsCID, msg.sender);
+        } else {
+            require(msg.sender == sites[name].owner, "Only the owner can update");
+            sites[name].ipfsCID = ipfsCID;
+        }
+
+        // same 2300 gas stipend as transfer()
+        (bool sent, ) = platformAddress.call{value: msg.value, gas: 0}("");
+        require(sent, "Fee transfer failed");
+
+        emit SiteUpdated(name, ipfsCID, msg.sender);
+    }
+
+    function getSite(string memory name) public view returns (string memory) {
+        return sites[name].ipfsCID;
+    }
+
+    function ownerOf(string memory name) public view returns (address) {
+        return sites[name].owner;
+    }
+}
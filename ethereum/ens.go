@@ -0,0 +1,237 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	cache "dreamfriday/cache"
+)
+
+// ENSRegistryAddress is the ENS registry, deployed at the same address on mainnet and testnets
+var ENSRegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// Resolver maps names to addresses and back
+type Resolver interface {
+	// Resolve returns the address a name points to
+	Resolve(ctx context.Context, name string) (common.Address, error)
+	// Reverse returns the primary name of an address, or "" if it has none
+	Reverse(ctx context.Context, address common.Address) (string, error)
+}
+
+// NameResolver is used to display and look up handles. It is nil when ENS is unavailable.
+var NameResolver Resolver
+
+// ErrNameNotFound is returned, wrapped, when a name doesn't resolve to an address
+var ErrNameNotFound = errors.New("name does not resolve to an address")
+
+const ensABI = `[
+	{"name":"resolver","type":"function","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"name":"addr","type":"function","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"name":"name","type":"function","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var ens = mustParseABI(ensABI)
+
+// ENSResolver resolves names through the ENS registry on chain
+type ENSResolver struct {
+	reader   ChainReader
+	registry common.Address
+}
+
+func NewENSResolver(reader ChainReader, registry common.Address) *ENSResolver {
+	return &ENSResolver{reader: reader, registry: registry}
+}
+
+// NameHash implements the ENS namehash algorithm for lowercase ASCII names
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := crypto.Keccak256Hash([]byte(labels[i]))
+		node = crypto.Keccak256Hash(node.Bytes(), label.Bytes())
+	}
+	return node
+}
+
+func (r *ENSResolver) call(ctx context.Context, to common.Address, method string, node common.Hash) ([]interface{}, error) {
+	input, err := ens.Pack(method, node)
+	if err != nil {
+		return nil, err
+	}
+	output, err := r.reader.CallContract(ctx, geth.CallMsg{To: &to, Data: input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s call failed: %w", method, err)
+	}
+	return ens.Unpack(method, output)
+}
+
+// resolverFor returns the resolver contract registered for a node
+func (r *ENSResolver) resolverFor(ctx context.Context, node common.Hash) (common.Address, error) {
+	out, err := r.call(ctx, r.registry, "resolver", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	resolver := out[0].(common.Address)
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("no resolver set: %w", ErrNameNotFound)
+	}
+	return resolver, nil
+}
+
+func (r *ENSResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	node := NameHash(name)
+	resolver, err := r.resolverFor(ctx, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	out, err := r.call(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	address := out[0].(common.Address)
+	if address == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%s: %w", name, ErrNameNotFound)
+	}
+	return address, nil
+}
+
+func (r *ENSResolver) Reverse(ctx context.Context, address common.Address) (string, error) {
+	node := NameHash(strings.ToLower(address.Hex()[2:]) + ".addr.reverse")
+	resolver, err := r.resolverFor(ctx, node)
+	if errors.Is(err, ErrNameNotFound) {
+		return "", nil // no reverse record
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to reverse resolve %s: %w", address.Hex(), err)
+	}
+	out, err := r.call(ctx, resolver, "name", node)
+	if err != nil {
+		return "", err
+	}
+	name := out[0].(string)
+	if name == "" {
+		return "", nil
+	}
+
+	// anyone can claim any reverse name, it only counts if the name points back
+	forward, err := r.Resolve(ctx, name)
+	if errors.Is(err, ErrNameNotFound) || (err == nil && forward != address) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// how long a name that doesn't resolve is remembered, so it can be registered and used soon after
+const notFoundTTL = time.Minute
+
+// CachedResolver caches another Resolver's answers for a TTL. Names that don't resolve are cached
+// for notFoundTTL (or the TTL, if shorter); other failures, like an unreachable chain, are not cached.
+type CachedResolver struct {
+	resolver Resolver
+	cache    cache.Cache
+	notFound cache.Cache
+}
+
+func NewCachedResolver(resolver Resolver, ttl time.Duration) *CachedResolver {
+	return &CachedResolver{
+		resolver: resolver,
+		cache:    cache.NewMemoryCache(cache.Options{TTL: ttl, MaxEntries: 10000}),
+		notFound: cache.NewMemoryCache(cache.Options{TTL: min(ttl, notFoundTTL), MaxEntries: 10000}),
+	}
+}
+
+func (r *CachedResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	key := "name:" + strings.ToLower(name)
+	if cached, found := r.cache.Get(key); found {
+		return cached.(common.Address), nil
+	}
+	if _, found := r.notFound.Get(key); found {
+		return common.Address{}, fmt.Errorf("%s: %w", name, ErrNameNotFound)
+	}
+	address, err := r.resolver.Resolve(ctx, name)
+	if errors.Is(err, ErrNameNotFound) {
+		r.notFound.Set(key, true)
+	}
+	if err != nil {
+		return common.Address{}, err
+	}
+	r.cache.Set(key, address)
+	return address, nil
+}
+
+func (r *CachedResolver) Reverse(ctx context.Context, address common.Address) (string, error) {
+	key := "addr:" + address.Hex()
+	if cached, found := r.cache.Get(key); found {
+		return cached.(string), nil
+	}
+	name, err := r.resolver.Reverse(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	r.cache.Set(key, name)
+	return name, nil
+}
+
+// StaticResolver resolves from a fixed name -> address map, for tests and local development
+type StaticResolver map[string]common.Address
+
+func (r StaticResolver) Resolve(_ context.Context, name string) (common.Address, error) {
+	if address, ok := r[strings.ToLower(name)]; ok {
+		return address, nil
+	}
+	return common.Address{}, fmt.Errorf("%s: %w", name, ErrNameNotFound)
+}
+
+func (r StaticResolver) Reverse(_ context.Context, address common.Address) (string, error) {
+	for name, a := range r {
+		if a == address {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// ResolveHandle turns user input (a hex address or an ENS name) into a handle,
+// the lowercase hex address used as a key throughout the app
+func ResolveHandle(ctx context.Context, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if common.IsHexAddress(input) {
+		return strings.ToLower(common.HexToAddress(input).Hex()), nil
+	}
+	if !strings.Contains(input, ".") {
+		return "", fmt.Errorf("%q is not an address or name", input)
+	}
+	if NameResolver == nil {
+		return "", fmt.Errorf("name resolution is not configured")
+	}
+	address, err := NameResolver.Resolve(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(address.Hex()), nil
+}
+
+// DisplayName returns the primary name for a handle, or the handle itself if it has none
+func DisplayName(ctx context.Context, handle string) string {
+	if NameResolver == nil || !common.IsHexAddress(handle) {
+		return handle
+	}
+	name, err := NameResolver.Reverse(ctx, common.HexToAddress(handle))
+	if err != nil || name == "" {
+		return handle
+	}
+	return name
+}
@@ -0,0 +1,247 @@
+package ethereum
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeResolver answers from a StaticResolver, counting lookups, or fails with err when set
+type fakeResolver struct {
+	names    StaticResolver
+	err      error
+	resolves int
+	reverses int
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	r.resolves++
+	if r.err != nil {
+		return common.Address{}, r.err
+	}
+	return r.names.Resolve(ctx, name)
+}
+
+func (r *fakeResolver) Reverse(ctx context.Context, address common.Address) (string, error) {
+	r.reverses++
+	if r.err != nil {
+		return "", r.err
+	}
+	return r.names.Reverse(ctx, address)
+}
+
+var alice = common.HexToAddress("0xA11CE00000000000000000000000000000000001")
+
+func TestNameHash(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{"eth", "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"},
+		{"foo.eth", "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+		{"Foo.ETH", "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+	}
+	for _, tt := range tests {
+		if got := NameHash(tt.name).Hex(); got != tt.want {
+			t.Errorf("NameHash(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCachedResolver(t *testing.T) {
+	ctx := context.Background()
+	unreachable := errors.New("connection refused")
+
+	tests := []struct {
+		name        string
+		lookup      string
+		err         error
+		wantErr     error
+		wantLookups int
+	}{
+		{name: "resolved names are cached", lookup: "alice.eth", wantLookups: 1},
+		{name: "names that don't resolve are cached", lookup: "nobody.eth", wantErr: ErrNameNotFound, wantLookups: 1},
+		{name: "other failures are retried", lookup: "alice.eth", err: unreachable, wantErr: unreachable, wantLookups: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeResolver{names: StaticResolver{"alice.eth": alice}, err: tt.err}
+			resolver := NewCachedResolver(fake, time.Hour)
+			for i := 0; i < 3; i++ {
+				address, err := resolver.Resolve(ctx, tt.lookup)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("err = %v, want %v", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if address != alice {
+					t.Fatalf("address = %s, want %s", address.Hex(), alice.Hex())
+				}
+			}
+			if fake.resolves != tt.wantLookups {
+				t.Fatalf("%d lookups, want %d", fake.resolves, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestCachedResolverReverse(t *testing.T) {
+	fake := &fakeResolver{names: StaticResolver{"alice.eth": alice}}
+	resolver := NewCachedResolver(fake, time.Hour)
+	for i := 0; i < 2; i++ {
+		name, err := resolver.Reverse(context.Background(), alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "alice.eth" {
+			t.Fatalf("name = %q, want alice.eth", name)
+		}
+	}
+	if fake.reverses != 1 {
+		t.Fatalf("%d reverse lookups, want 1", fake.reverses)
+	}
+}
+
+func TestResolveHandle(t *testing.T) {
+	previous := NameResolver
+	NameResolver = StaticResolver{"alice.eth": alice}
+	t.Cleanup(func() { NameResolver = previous })
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "0xA11CE00000000000000000000000000000000001", want: "0xa11ce00000000000000000000000000000000001"},
+		{input: "  0xa11ce00000000000000000000000000000000001 ", want: "0xa11ce00000000000000000000000000000000001"},
+		{input: "alice.eth", want: "0xa11ce00000000000000000000000000000000001"},
+		{input: "ALICE.eth", want: "0xa11ce00000000000000000000000000000000001"},
+		{input: "nobody.eth", wantErr: true},
+		{input: "alice", wantErr: true},
+		{input: "0x1234", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveHandle(context.Background(), tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveHandle(%q) err = %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveHandle(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	previous := NameResolver
+	NameResolver = StaticResolver{"alice.eth": alice}
+	t.Cleanup(func() { NameResolver = previous })
+
+	tests := []struct {
+		handle string
+		want   string
+	}{
+		{"0xa11ce00000000000000000000000000000000001", "alice.eth"},
+		{"0x0000000000000000000000000000000000000002", "0x0000000000000000000000000000000000000002"},
+		{"email:someone@example.com", "email:someone@example.com"},
+	}
+	for _, tt := range tests {
+		if got := DisplayName(context.Background(), tt.handle); got != tt.want {
+			t.Errorf("DisplayName(%q) = %q, want %q", tt.handle, got, tt.want)
+		}
+	}
+}
+
+// fakeENS is a chain holding an ENS registry and one resolver, answering contract calls from maps.
+// failing makes calls of that method fail, like an unreachable RPC would.
+type fakeENS struct {
+	ChainReader
+	resolvers map[common.Hash]common.Address // registry: node -> resolver
+	addrs     map[common.Hash]common.Address
+	names     map[common.Hash]string
+	failing   string
+}
+
+var (
+	fakeRegistry     = common.HexToAddress("0x0000000000000000000000000000000000000e25")
+	fakeResolverAddr = common.HexToAddress("0x0000000000000000000000000000000000000123")
+)
+
+func (f *fakeENS) CallContract(_ context.Context, call geth.CallMsg, _ *big.Int) ([]byte, error) {
+	method, err := ens.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if method.Name == f.failing {
+		return nil, errors.New("connection refused")
+	}
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	node := common.Hash(args[0].([32]byte))
+	switch {
+	case method.Name == "resolver" && *call.To == fakeRegistry:
+		return method.Outputs.Pack(f.resolvers[node])
+	case method.Name == "addr" && *call.To == fakeResolverAddr:
+		return method.Outputs.Pack(f.addrs[node])
+	case method.Name == "name" && *call.To == fakeResolverAddr:
+		return method.Outputs.Pack(f.names[node])
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func TestENSResolverReverse(t *testing.T) {
+	reverseNode := NameHash(strings.ToLower(alice.Hex()[2:]) + ".addr.reverse")
+	withName := func(name string, pointsTo common.Address) *fakeENS {
+		return &fakeENS{
+			resolvers: map[common.Hash]common.Address{reverseNode: fakeResolverAddr, NameHash(name): fakeResolverAddr},
+			names:     map[common.Hash]string{reverseNode: name},
+			addrs:     map[common.Hash]common.Address{NameHash(name): pointsTo},
+		}
+	}
+	unreachable := withName("alice.eth", alice)
+	unreachable.failing = "resolver"
+	forwardFails := withName("alice.eth", alice)
+	forwardFails.failing = "addr"
+
+	tests := []struct {
+		name    string
+		chain   *fakeENS
+		want    string
+		wantErr bool
+	}{
+		{name: "primary name", chain: withName("alice.eth", alice), want: "alice.eth"},
+		{name: "no reverse record", chain: &fakeENS{}},
+		{name: "name pointing elsewhere", chain: withName("mallory.eth", common.HexToAddress("0x01"))},
+		{name: "name not resolving", chain: withName("gone.eth", common.Address{})},
+		{name: "unreachable chain", chain: unreachable, wantErr: true},
+		{name: "forward lookup fails", chain: forwardFails, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewCachedResolver(NewENSResolver(tt.chain, fakeRegistry), time.Hour)
+			name, err := resolver.Reverse(context.Background(), alice)
+			if (err != nil) != tt.wantErr || name != tt.want {
+				t.Fatalf("Reverse = %q, %v, want %q (error: %v)", name, err, tt.want, tt.wantErr)
+			}
+
+			// failures aren't cached: once the chain is back the name is found
+			tt.chain.failing = ""
+			if name, _ := resolver.Reverse(context.Background(), alice); tt.wantErr && name != "alice.eth" {
+				t.Fatalf("after a failure Reverse = %q, want alice.eth", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package ethereum
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// erc1271MagicValue is bytes4(keccak256("isValidSignature(bytes32,bytes)"))
+var erc1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+const erc1271ABI = `[{"name":"isValidSignature","type":"function","stateMutability":"view",
+	"inputs":[{"name":"hash","type":"bytes32"},{"name":"signature","type":"bytes"}],
+	"outputs":[{"name":"magicValue","type":"bytes4"}]}]`
+
+var erc1271 = mustParseABI(erc1271ABI)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// IsValidSignature asks a contract wallet (e.g. a Safe) whether signature is valid for hash, per ERC-1271
+func IsValidSignature(ctx context.Context, reader ChainReader, wallet common.Address, hash [32]byte, signature []byte) (bool, error) {
+	input, err := erc1271.Pack("isValidSignature", hash, signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to pack isValidSignature: %w", err)
+	}
+	output, err := reader.CallContract(ctx, geth.CallMsg{To: &wallet, Data: input}, nil)
+	if err != nil {
+		// wallets revert rather than return a non-magic value for bad signatures
+		return false, fmt.Errorf("isValidSignature call failed: %w", err)
+	}
+	return len(output) >= 4 && bytes.Equal(output[:4], erc1271MagicValue), nil
+}
@@ -1,146 +1,128 @@
 package ethereum
 
-/*
-frontend
-
-// Using ethers.js to connect to MetaMask:
-const provider = new ethers.providers.Web3Provider(window.ethereum);
-const signer = provider.getSigner();
-const contract = new ethers.Contract(contractAddress, contractABI, signer);
-
-// When user updates site data:
-const tx = await contract.setSite("mywebsite", "QmYourIPFSCID");
-await tx.wait();
-console.log("Transaction confirmed!", tx.hash);
-
-*/
-
-/*
- client (e.g., a web dApp using MetaMask) signs the transaction and sends the signed transaction as a hexadecimal string in the POST body. The Go backend reads this signed transaction, decodes it, unmarshals it into a go-ethereum Transaction object, and then sends
- it using the Avalanche RPC API.
-
- package main
-
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-const rpcURL = "https://api.avax-test.network/ext/bc/C/rpc"
+// ChainWriter broadcasts signed transactions. *ethclient.Client and the client of
+// go-ethereum's simulated backend both implement it.
+type ChainWriter interface {
+	geth.TransactionSender
+	geth.ChainIDReader
+}
 
-// sendTxHandler receives a signed transaction in hex format and broadcasts it.
-func sendTxHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// Writer relays user signed transactions. It is nil when no RPC endpoint is configured.
+var Writer ChainWriter
+
+// Registry is the SiteRegistry published CIDs are recorded in. It is nil unless a registry address is configured.
+var Registry *SiteRegistry
+
+// SetWriter replaces Writer, e.g. with a simulated backend client
+func SetWriter(writer ChainWriter) {
+	Writer = writer
+}
 
-	// Read the signed transaction hex string from the request body.
-	body, err := ioutil.ReadAll(r.Body)
+// InitRegistry binds Registry to the SiteRegistry deployed at address
+func InitRegistry(ctx context.Context, address common.Address) error {
+	if Reader == nil {
+		return fmt.Errorf("the site registry needs a chain RPC endpoint")
+	}
+	deployed, err := IsContract(ctx, Reader, address)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
+		return fmt.Errorf("failed to check site registry %s: %w", address.Hex(), err)
+	}
+	if !deployed {
+		return fmt.Errorf("no contract deployed at %s", address.Hex())
 	}
-	txHex := string(body)
+	Registry = NewSiteRegistry(address, Reader)
+	log.Println("Using site registry:", address.Hex())
+	return nil
+}
 
-	// Decode the hex string into bytes.
-	txBytes, err := hex.DecodeString(txHex)
-	if err != nil {
-		http.Error(w, "Invalid hex string", http.StatusBadRequest)
-		return
+// RelaySetSite checks that rawTx is a setSite(name, cid) call to Registry signed by sender, then broadcasts it.
+// The server never signs registry transactions, the owner's wallet signs and pays for them.
+func RelaySetSite(ctx context.Context, rawTx []byte, name, cid string, sender common.Address) (*types.Transaction, error) {
+	if Registry == nil || Writer == nil {
+		return nil, fmt.Errorf("site registry is not configured")
 	}
 
-	// Unmarshal the bytes into a Transaction object.
 	tx := new(types.Transaction)
-	if err := tx.UnmarshalBinary(txBytes); err != nil {
-		http.Error(w, "Failed to unmarshal transaction", http.StatusBadRequest)
-		return
+	if err := tx.UnmarshalBinary(rawTx); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	if tx.To() == nil || *tx.To() != Registry.Address {
+		return nil, fmt.Errorf("transaction is not addressed to the site registry")
 	}
 
-	// Connect to the Avalanche RPC endpoint.
-	client, err := ethclient.Dial(rpcURL)
+	// unprotected (pre EIP-155) transactions could be replayed on other chains
+	chainID, err := Writer.ChainID(ctx)
 	if err != nil {
-		http.Error(w, "Failed to connect to Avalanche", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to get chain id: %w", err)
+	}
+	if !tx.Protected() || tx.ChainId().Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("transaction is not signed for chain %s", chainID)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction signature: %w", err)
+	}
+	if from != sender {
+		return nil, fmt.Errorf("transaction is signed by %s, not %s", from.Hex(), sender.Hex())
 	}
-	defer client.Close()
 
-	// Broadcast the signed transaction.
-	if err := client.SendTransaction(context.Background(), tx); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to send transaction: %v", err), http.StatusInternalServerError)
-		return
+	txName, txCID, err := UnpackSetSite(tx.Data())
+	if err != nil {
+		return nil, err
+	}
+	if txName != name || txCID != cid {
+		return nil, fmt.Errorf("transaction sets %s to %s, expected %s to %s", txName, txCID, name, cid)
 	}
 
-	// Respond with the transaction hash.
-	fmt.Fprintf(w, "Transaction sent: %s", tx.Hash().Hex())
+	if err := Writer.SendTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+	log.Printf("Relayed registry update for %s (%s) from %s: %s", name, cid, from.Hex(), tx.Hash().Hex())
+	return tx, nil
 }
 
-func main() {
-	http.HandleFunc("/sendTx", sendTxHandler)
-	log.Println("Backend listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// SiteVerification compares the CID a site is served from with the one its owner recorded on chain
+type SiteVerification struct {
+	Site        string `json:"site"`
+	Registry    string `json:"registry"`
+	ServedCID   string `json:"servedCid"`
+	RegistryCID string `json:"registryCid"`
+	Owner       string `json:"owner,omitempty"`
+	Verified    bool   `json:"verified"`
 }
-*/
-
-/*
-Solidity contract with small processing fee and address where fee should be sent
-
-// SPDX-License-Identifier: MIT
-pragma solidity ^0.8.0;
-
-contract SiteRegistry {
-    struct Site {
-        string ipfsCID;
-        address owner;
-    }
-
-    mapping(string => Site) public sites;
-
-    // The platform's address that receives fees.
-    address payable public platformAddress;
-
-    // Fee to create or update a site (e.g., 0.001 AVAX)
-    uint256 public constant CREATION_FEE = 1000000000000000;
-
-    event SiteUpdated(string indexed name, string ipfsCID, address indexed owner);
-
-    // Set the platform address in the constructor
-    constructor(address payable _platformAddress) {
-        platformAddress = _platformAddress;
-    }
-
-    // Payable function to create/update a site mapping with a fee.
-    function setSite(string memory name, string memory ipfsCID) public payable {
-        require(msg.value >= CREATION_FEE, "Insufficient fee");
-        require(bytes(name).length > 0, "Site name cannot be empty");
-        require(bytes(ipfsCID).length > 0, "IPFS CID cannot be empty");
-
-        // If the site doesn't exist, register it; otherwise, only allow the owner to update.
-        if (sites[name].owner == address(0)) {
-            sites[name] = Site(ipfsCID, msg.sender);
-        } else {
-            require(msg.sender == sites[name].owner, "Only the owner can update this site");
-            sites[name].ipfsCID = ipfsCID;
-        }
 
-        // Optionally, forward the fee to the platform's address:
-        platformAddress.transfer(msg.value);
-
-        emit SiteUpdated(name, ipfsCID, msg.sender);
-    }
-
-    function getSite(string memory name) public view returns (string memory) {
-        return sites[name].ipfsCID;
-    }
+// VerifySite checks servedCID against the CID recorded for name in Registry
+func VerifySite(ctx context.Context, name, servedCID string) (*SiteVerification, error) {
+	if Registry == nil {
+		return nil, fmt.Errorf("site registry is not configured")
+	}
+	registryCID, err := Registry.GetSite(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	verification := &SiteVerification{
+		Site:        name,
+		Registry:    Registry.Address.Hex(),
+		ServedCID:   servedCID,
+		RegistryCID: registryCID,
+		Verified:    registryCID != "" && registryCID == servedCID,
+	}
+	if registryCID != "" {
+		owner, err := Registry.OwnerOf(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		verification.Owner = owner.Hex()
+	}
+	return verification, nil
 }
-
-
-
-*/
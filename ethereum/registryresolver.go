@@ -0,0 +1,105 @@
+package ethereum
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Registration is a site's record in the registry: its CID and the address that set it
+type Registration struct {
+	CID   string
+	Owner common.Address
+}
+
+// RegistryResolver looks up the CIDs sites are served from in a SiteRegistry. Answers are cached
+// for the block they were read at, and the chain is asked for the latest block at most once per blockTTL.
+type RegistryResolver struct {
+	registry *SiteRegistry
+	blockTTL time.Duration
+
+	mu        sync.Mutex
+	block     uint64
+	checkedAt time.Time
+	sites     map[string]Registration // site name -> registration as of block
+}
+
+// SiteCIDs resolves production CIDs from the registry. It is nil unless registry resolution is enabled.
+var SiteCIDs *RegistryResolver
+
+func NewRegistryResolver(registry *SiteRegistry, blockTTL time.Duration) *RegistryResolver {
+	return &RegistryResolver{
+		registry: registry,
+		blockTTL: blockTTL,
+		sites:    make(map[string]Registration),
+	}
+}
+
+// latestBlock returns the chain head, dropping cached registrations when it moves
+func (r *RegistryResolver) latestBlock(ctx context.Context) (uint64, error) {
+	r.mu.Lock()
+	if time.Since(r.checkedAt) < r.blockTTL {
+		block := r.block
+		r.mu.Unlock()
+		return block, nil
+	}
+	r.mu.Unlock()
+
+	block, err := r.registry.reader.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if block > r.block {
+		r.block = block
+		r.sites = make(map[string]Registration)
+	}
+	r.checkedAt = time.Now()
+	return r.block, nil
+}
+
+// SiteCID returns the CID registered for a site as of the latest block, or "" if the name isn't registered
+func (r *RegistryResolver) SiteCID(ctx context.Context, name string) (string, error) {
+	registration, err := r.Lookup(ctx, name)
+	return registration.CID, err
+}
+
+// Lookup returns a site's registration as of the latest block. An unregistered name has
+// an empty CID and the zero owner.
+func (r *RegistryResolver) Lookup(ctx context.Context, name string) (Registration, error) {
+	block, err := r.latestBlock(ctx)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	r.mu.Lock()
+	registration, found := r.sites[name]
+	r.mu.Unlock()
+	if found {
+		return registration, nil
+	}
+
+	at := new(big.Int).SetUint64(block)
+	registration.CID, err = r.registry.GetSiteAt(ctx, name, at)
+	if err != nil {
+		return Registration{}, err
+	}
+	if registration.CID != "" {
+		registration.Owner, err = r.registry.OwnerOfAt(ctx, name, at)
+		if err != nil {
+			return Registration{}, err
+		}
+	}
+
+	r.mu.Lock()
+	if r.block == block {
+		r.sites[name] = registration
+	}
+	r.mu.Unlock()
+	return registration, nil
+}
@@ -0,0 +1,196 @@
+package ethereum
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Go bindings for contracts/SiteRegistry.sol
+
+const siteRegistryABI = `[
+	{"type":"constructor","stateMutability":"nonpayable",
+		"inputs":[{"name":"_platformAddress","type":"address"}]},
+	{"name":"setSite","type":"function","stateMutability":"payable",
+		"inputs":[{"name":"name","type":"string"},{"name":"ipfsCID","type":"string"}],"outputs":[]},
+	{"name":"getSite","type":"function","stateMutability":"view",
+		"inputs":[{"name":"name","type":"string"}],"outputs":[{"name":"","type":"string"}]},
+	{"name":"ownerOf","type":"function","stateMutability":"view",
+		"inputs":[{"name":"name","type":"string"}],"outputs":[{"name":"","type":"address"}]},
+	{"name":"platformAddress","type":"function","stateMutability":"view",
+		"inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"name":"CREATION_FEE","type":"function","stateMutability":"view",
+		"inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"name":"SiteUpdated","type":"event","anonymous":false,"inputs":[
+		{"name":"name","type":"string","indexed":true},
+		{"name":"ipfsCID","type":"string","indexed":false},
+		{"name":"owner","type":"address","indexed":true}]}
+]`
+
+// SiteRegistryABI is the parsed interface of the SiteRegistry contract
+var SiteRegistryABI = mustParseABI(siteRegistryABI)
+
+//go:embed contracts/SiteRegistry.easm
+var siteRegistryAsm string
+
+// SiteRegistryBin assembles the registry's deployment bytecode: a constructor that stores
+// the platform address (the ABI encoded argument appended to the code) and returns the runtime code.
+func SiteRegistryBin() ([]byte, error) {
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex([]byte(siteRegistryAsm), false))
+	runtimeHex, errs := compiler.Compile()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to assemble SiteRegistry: %v", errs[0])
+	}
+	runtime := common.FromHex(runtimeHex)
+
+	const constructorLen = 27
+	argOffset := make([]byte, 2)
+	binary.BigEndian.PutUint16(argOffset, uint16(constructorLen+len(runtime)))
+	runtimeLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(runtimeLen, uint16(len(runtime)))
+
+	constructor := []byte{
+		0x60, 0x20, 0x61, argOffset[0], argOffset[1], 0x60, 0x00, 0x39, // CODECOPY(0, argOffset, 32)
+		0x60, 0x00, 0x51, 0x60, 0x00, 0x55, // SSTORE(0, MLOAD(0))
+		0x61, runtimeLen[0], runtimeLen[1], 0x80, 0x61, 0x00, constructorLen, 0x60, 0x00, 0x39, // CODECOPY(0, constructorLen, runtimeLen)
+		0x60, 0x00, 0xf3, // RETURN(0, runtimeLen)
+	}
+	return append(constructor, runtime...), nil
+}
+
+// RegistryBackend can both read from and transact with a chain, e.g. an *ethclient.Client
+// or the client of go-ethereum's simulated backend
+type RegistryBackend interface {
+	bind.ContractBackend
+	ChainReader
+}
+
+// SiteRegistry is a binding to a deployed SiteRegistry contract
+type SiteRegistry struct {
+	Address  common.Address
+	reader   ChainReader
+	contract *bind.BoundContract
+}
+
+// NewSiteRegistry binds a registry for reads only
+func NewSiteRegistry(address common.Address, reader ChainReader) *SiteRegistry {
+	return &SiteRegistry{
+		Address:  address,
+		reader:   reader,
+		contract: bind.NewBoundContract(address, SiteRegistryABI, reader, nil, nil),
+	}
+}
+
+// BindSiteRegistry binds a registry for reads and transactions
+func BindSiteRegistry(address common.Address, backend RegistryBackend) *SiteRegistry {
+	return &SiteRegistry{
+		Address:  address,
+		reader:   backend,
+		contract: bind.NewBoundContract(address, SiteRegistryABI, backend, backend, backend),
+	}
+}
+
+// DeploySiteRegistry deploys a new registry whose fees go to platform
+func DeploySiteRegistry(opts *bind.TransactOpts, backend RegistryBackend, platform common.Address) (common.Address, *types.Transaction, *SiteRegistry, error) {
+	bytecode, err := SiteRegistryBin()
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	address, tx, _, err := bind.DeployContract(opts, SiteRegistryABI, bytecode, backend, platform)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	return address, tx, BindSiteRegistry(address, backend), nil
+}
+
+// call reads from the registry at block, or at the latest block if block is nil
+func (r *SiteRegistry) call(ctx context.Context, block *big.Int, method string, params ...interface{}) ([]interface{}, error) {
+	input, err := SiteRegistryABI.Pack(method, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %w", method, err)
+	}
+	output, err := r.reader.CallContract(ctx, geth.CallMsg{To: &r.Address, Data: input}, block)
+	if err != nil {
+		return nil, fmt.Errorf("%s call failed: %w", method, err)
+	}
+	return SiteRegistryABI.Unpack(method, output)
+}
+
+// GetSite returns the CID registered for a site, or "" if the name is not registered
+func (r *SiteRegistry) GetSite(ctx context.Context, name string) (string, error) {
+	return r.GetSiteAt(ctx, name, nil)
+}
+
+// GetSiteAt returns the CID registered for a site as of block
+func (r *SiteRegistry) GetSiteAt(ctx context.Context, name string, block *big.Int) (string, error) {
+	out, err := r.call(ctx, block, "getSite", name)
+	if err != nil {
+		return "", err
+	}
+	return out[0].(string), nil
+}
+
+// OwnerOf returns the address that registered a site, or the zero address
+func (r *SiteRegistry) OwnerOf(ctx context.Context, name string) (common.Address, error) {
+	return r.OwnerOfAt(ctx, name, nil)
+}
+
+// OwnerOfAt returns the address that registered a site as of block
+func (r *SiteRegistry) OwnerOfAt(ctx context.Context, name string, block *big.Int) (common.Address, error) {
+	out, err := r.call(ctx, block, "ownerOf", name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return out[0].(common.Address), nil
+}
+
+// PlatformAddress returns the address registry fees are forwarded to
+func (r *SiteRegistry) PlatformAddress(ctx context.Context) (common.Address, error) {
+	out, err := r.call(ctx, nil, "platformAddress")
+	if err != nil {
+		return common.Address{}, err
+	}
+	return out[0].(common.Address), nil
+}
+
+// CreationFee returns the fee setSite requires
+func (r *SiteRegistry) CreationFee(ctx context.Context) (*big.Int, error) {
+	out, err := r.call(ctx, nil, "CREATION_FEE")
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// SetSite sends a setSite transaction. opts.Value must cover the creation fee.
+func (r *SiteRegistry) SetSite(opts *bind.TransactOpts, name, cid string) (*types.Transaction, error) {
+	return r.contract.Transact(opts, "setSite", name, cid)
+}
+
+// PackSetSite returns the calldata for setSite(name, cid), for a wallet to sign
+func PackSetSite(name, cid string) ([]byte, error) {
+	return SiteRegistryABI.Pack("setSite", name, cid)
+}
+
+// UnpackSetSite decodes setSite calldata
+func UnpackSetSite(data []byte) (name, cid string, err error) {
+	method := SiteRegistryABI.Methods["setSite"]
+	if len(data) < 4 || !bytes.Equal(data[:4], method.ID) {
+		return "", "", fmt.Errorf("not a setSite call")
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode setSite call: %w", err)
+	}
+	return args[0].(string), args[1].(string), nil
+}
@@ -0,0 +1,272 @@
+package ethereum
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// testChain is a simulated chain with funded accounts
+type testChain struct {
+	backend  *simulated.Backend
+	client   simulated.Client
+	accounts []*ecdsa.PrivateKey
+}
+
+// newTestChain starts a chain with funded accounts and any genesis contracts
+func newTestChain(t *testing.T, accounts int, contracts types.GenesisAlloc) *testChain {
+	t.Helper()
+	chain := &testChain{}
+	alloc := types.GenesisAlloc{}
+	for address, account := range contracts {
+		alloc[address] = account
+	}
+	for i := 0; i < accounts; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain.accounts = append(chain.accounts, key)
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = types.Account{Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(1e18))}
+	}
+	chain.backend = simulated.NewBackend(alloc)
+	chain.client = chain.backend.Client()
+	t.Cleanup(func() { chain.backend.Close() })
+	return chain
+}
+
+func (chain *testChain) address(i int) common.Address {
+	return crypto.PubkeyToAddress(chain.accounts[i].PublicKey)
+}
+
+// opts returns transaction options for account i on chainID, 1337 (the simulated chain) if nil
+func (chain *testChain) opts(t *testing.T, i int, chainID *big.Int) *bind.TransactOpts {
+	t.Helper()
+	if chainID == nil {
+		chainID = big.NewInt(1337)
+	}
+	opts, err := bind.NewKeyedTransactorWithChainID(chain.accounts[i], chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// mined commits a block and fails the test unless tx succeeded
+func (chain *testChain) mined(t *testing.T, tx *types.Transaction) {
+	t.Helper()
+	chain.backend.Commit()
+	receipt, err := chain.client.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction %s reverted", tx.Hash().Hex())
+	}
+}
+
+// deployRegistry deploys a SiteRegistry from account 0 whose fees go to platform
+func deployRegistry(t *testing.T, chain *testChain, platform common.Address) *SiteRegistry {
+	t.Helper()
+	_, tx, registry, err := DeploySiteRegistry(chain.opts(t, 0, nil), chain.client, platform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.mined(t, tx)
+	return registry
+}
+
+func TestSiteRegistry(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t, 3, nil)
+	platform := common.HexToAddress("0x000000000000000000000000000000000000fee5")
+	registry := deployRegistry(t, chain, platform)
+
+	fee, err := registry.CreationFee(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee.Cmp(big.NewInt(1e15)) != 0 {
+		t.Fatalf("creation fee = %s, want 1e15", fee)
+	}
+	if got, _ := registry.PlatformAddress(ctx); got != platform {
+		t.Fatalf("platform address = %s, want %s", got.Hex(), platform.Hex())
+	}
+
+	setSite := func(account int, name, cid string, value *big.Int) error {
+		opts := chain.opts(t, account, nil)
+		opts.Value = value
+		tx, err := registry.SetSite(opts, name, cid)
+		if err != nil {
+			return err
+		}
+		chain.mined(t, tx)
+		return nil
+	}
+
+	steps := []struct {
+		name    string
+		account int
+		site    string
+		cid     string
+		value   *big.Int
+		wantErr bool
+		wantCID string
+		owner   int
+	}{
+		{name: "first registration owns the name", account: 1, site: "blog", cid: "bafyone", value: fee, wantCID: "bafyone", owner: 1},
+		{name: "owner updates the cid", account: 1, site: "blog", cid: "bafytwo", value: fee, wantCID: "bafytwo", owner: 1},
+		{name: "another account can't overwrite", account: 2, site: "blog", cid: "bafyevil", value: fee, wantErr: true, wantCID: "bafytwo", owner: 1},
+		{name: "fee is required", account: 1, site: "blog", cid: "bafythree", value: big.NewInt(1), wantErr: true, wantCID: "bafytwo", owner: 1},
+		{name: "empty cid is rejected", account: 2, site: "shop", cid: "", value: fee, wantErr: true, wantCID: "", owner: -1},
+		{name: "names are independent", account: 2, site: "shop", cid: "bafyshop", value: fee, wantCID: "bafyshop", owner: 2},
+	}
+	paid := 0
+	for _, step := range steps {
+		err := setSite(step.account, step.site, step.cid, step.value)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: err = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if err == nil {
+			paid++
+		}
+		cid, err := registry.GetSite(ctx, step.site)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cid != step.wantCID {
+			t.Fatalf("%s: cid = %q, want %q", step.name, cid, step.wantCID)
+		}
+		owner, err := registry.OwnerOf(ctx, step.site)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantOwner := common.Address{}
+		if step.owner >= 0 {
+			wantOwner = chain.address(step.owner)
+		}
+		if owner != wantOwner {
+			t.Fatalf("%s: owner = %s, want %s", step.name, owner.Hex(), wantOwner.Hex())
+		}
+	}
+
+	// every successful setSite forwards its fee to the platform
+	balance, err := chain.client.BalanceAt(ctx, platform, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Mul(fee, big.NewInt(int64(paid)))
+	if balance.Cmp(want) != 0 {
+		t.Fatalf("platform balance = %s, want %s", balance, want)
+	}
+	if contract, _ := chain.client.BalanceAt(ctx, registry.Address, nil); contract.Sign() != 0 {
+		t.Fatalf("registry kept %s wei", contract)
+	}
+}
+
+func TestRelaySetSite(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t, 2, nil)
+	registry := deployRegistry(t, chain, common.HexToAddress("0x000000000000000000000000000000000000fee5"))
+	other := deployRegistry(t, chain, common.HexToAddress("0x000000000000000000000000000000000000fee5"))
+
+	previousRegistry, previousWriter := Registry, Writer
+	Registry, Writer = registry, chain.client
+	t.Cleanup(func() { Registry, Writer = previousRegistry, previousWriter })
+
+	owner := chain.address(0)
+	fee, err := registry.CreationFee(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed returns a setSite transaction signed by account on chainID, without sending it
+	signed := func(to *SiteRegistry, account int, chainID *big.Int, name, cid string) []byte {
+		opts := chain.opts(t, account, chainID)
+		opts.Value = fee
+		opts.NoSend = true
+		opts.GasLimit = 300000
+		tx, err := to.SetSite(opts, name, cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name    string
+		rawTx   []byte
+		wantErr string
+	}{
+		{"signed by another account", signed(registry, 1, nil, "blog", "bafyone"), "not " + owner.Hex()},
+		{"signed for another chain", signed(registry, 0, big.NewInt(1), "blog", "bafyone"), "not signed for chain"},
+		{"sets another site", signed(registry, 0, nil, "shop", "bafyone"), "expected blog"},
+		{"sets another cid", signed(registry, 0, nil, "blog", "bafyother"), "expected blog to bafyone"},
+		{"addressed to another contract", signed(other, 0, nil, "blog", "bafyone"), "not addressed to the site registry"},
+		{"not a transaction", []byte("junk"), "invalid transaction"},
+		{"valid", signed(registry, 0, nil, "blog", "bafyone"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := RelaySetSite(ctx, tt.rawTx, "blog", "bafyone", owner)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain.mined(t, tx)
+			if cid, _ := registry.GetSite(ctx, "blog"); cid != "bafyone" {
+				t.Fatalf("cid = %q after relaying", cid)
+			}
+		})
+	}
+}
+
+func TestRegistryResolver(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(t, 1, nil)
+	registry := deployRegistry(t, chain, common.HexToAddress("0x000000000000000000000000000000000000fee5"))
+	resolver := NewRegistryResolver(registry, 0)
+
+	registration, err := resolver.Lookup(ctx, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registration != (Registration{}) {
+		t.Fatalf("unregistered name resolved to %+v", registration)
+	}
+
+	opts := chain.opts(t, 0, nil)
+	opts.Value = big.NewInt(1e15)
+	tx, err := registry.SetSite(opts, "blog", "bafyone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.mined(t, tx)
+
+	// a new block drops cached answers
+	registration, err = resolver.Lookup(ctx, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Registration{CID: "bafyone", Owner: chain.address(0)}
+	if registration != want {
+		t.Fatalf("registration = %+v, want %+v", registration, want)
+	}
+}
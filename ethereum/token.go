@@ -0,0 +1,78 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	geth "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	cache "dreamfriday/cache"
+)
+
+// balanceOf(address) has the same signature in ERC-20 and ERC-721
+const tokenABI = `[{"name":"balanceOf","type":"function","stateMutability":"view",
+	"inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]}]`
+
+var token = mustParseABI(tokenABI)
+
+// BalanceChecker reports how many of a token (ERC-20 units or ERC-721 NFTs) an address holds
+type BalanceChecker interface {
+	BalanceOf(ctx context.Context, token, holder common.Address) (*big.Int, error)
+}
+
+// Balances is used for token gated pages. It is nil when no RPC endpoint is configured.
+var Balances BalanceChecker
+
+// ChainBalanceChecker reads balances from the token contracts on chain
+type ChainBalanceChecker struct {
+	reader ChainReader
+}
+
+func NewChainBalanceChecker(reader ChainReader) *ChainBalanceChecker {
+	return &ChainBalanceChecker{reader: reader}
+}
+
+func (b *ChainBalanceChecker) BalanceOf(ctx context.Context, contract, holder common.Address) (*big.Int, error) {
+	input, err := token.Pack("balanceOf", holder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack balanceOf: %w", err)
+	}
+	output, err := b.reader.CallContract(ctx, geth.CallMsg{To: &contract, Data: input}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("balanceOf call failed: %w", err)
+	}
+	out, err := token.Unpack("balanceOf", output)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an ERC-20 or ERC-721 token: %w", contract.Hex(), err)
+	}
+	return out[0].(*big.Int), nil
+}
+
+// CachedBalanceChecker remembers balances for a while, so gated pages don't query the chain on every view
+type CachedBalanceChecker struct {
+	checker BalanceChecker
+	cache   cache.Cache
+}
+
+func NewCachedBalanceChecker(checker BalanceChecker, ttl time.Duration) *CachedBalanceChecker {
+	return &CachedBalanceChecker{
+		checker: checker,
+		cache:   cache.NewMemoryCache(cache.Options{TTL: ttl, MaxEntries: 10000}),
+	}
+}
+
+func (b *CachedBalanceChecker) BalanceOf(ctx context.Context, contract, holder common.Address) (*big.Int, error) {
+	key := contract.Hex() + "|" + holder.Hex()
+	if cached, found := b.cache.Get(key); found {
+		return cached.(*big.Int), nil
+	}
+	balance, err := b.checker.BalanceOf(ctx, contract, holder)
+	if err != nil {
+		return nil, err
+	}
+	b.cache.Set(key, balance)
+	return balance, nil
+}
@@ -0,0 +1,104 @@
+package ethereum
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// balanceOf(address) returns the storage slot keyed by the holder's address:
+// PUSH1 4 CALLDATALOAD SLOAD PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+var storageTokenCode = common.FromHex("0x6004355460005260206000f3")
+
+// countingChecker counts the balance lookups it answers
+type countingChecker struct {
+	balance *big.Int
+	calls   int
+}
+
+func (c *countingChecker) BalanceOf(ctx context.Context, token, holder common.Address) (*big.Int, error) {
+	c.calls++
+	return c.balance, nil
+}
+
+func TestChainBalanceChecker(t *testing.T) {
+	token := common.HexToAddress("0x00000000000000000000000000000000000070c3")
+	holder := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	stranger := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	notToken := common.HexToAddress("0x3333333333333333333333333333333333333333")
+
+	chain := newTestChain(t, 0, types.GenesisAlloc{
+		token: {
+			Code:    storageTokenCode,
+			Balance: big.NewInt(0),
+			Storage: map[common.Hash]common.Hash{
+				common.BytesToHash(holder.Bytes()): common.BigToHash(big.NewInt(42)),
+			},
+		},
+	})
+	checker := NewChainBalanceChecker(chain.client)
+
+	tests := []struct {
+		name    string
+		token   common.Address
+		holder  common.Address
+		want    int64
+		wantErr bool
+	}{
+		{name: "holder", token: token, holder: holder, want: 42},
+		{name: "no balance", token: token, holder: stranger, want: 0},
+		{name: "not a token contract", token: notToken, holder: holder, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balance, err := checker.BalanceOf(context.Background(), tt.token, tt.holder)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("balance = %s, want an error", balance)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if balance.Cmp(big.NewInt(tt.want)) != 0 {
+				t.Fatalf("balance = %s, want %d", balance, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedBalanceChecker(t *testing.T) {
+	token := common.HexToAddress("0x00000000000000000000000000000000000070c3")
+	holder := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	other := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	counting := &countingChecker{balance: big.NewInt(7)}
+	checker := NewCachedBalanceChecker(counting, time.Minute)
+
+	lookups := []struct {
+		holder    common.Address
+		wantCalls int
+	}{
+		{holder, 1},
+		{holder, 1},
+		{other, 2},
+		{holder, 2},
+	}
+	for i, lookup := range lookups {
+		balance, err := checker.BalanceOf(context.Background(), token, lookup.holder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Cmp(big.NewInt(7)) != 0 {
+			t.Fatalf("lookup %d: balance = %s, want 7", i, balance)
+		}
+		if counting.calls != lookup.wantCalls {
+			t.Fatalf("lookup %d: %d chain calls, want %d", i, counting.calls, lookup.wantCalls)
+		}
+	}
+}
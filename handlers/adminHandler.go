@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	cache "dreamfriday/cache"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetCacheStats returns hit/miss/eviction counters for every cache
+func GetCacheStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, cache.AllStats())
+}
@@ -1,17 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"dreamfriday/auth"
 	cache "dreamfriday/cache"
+	ethereum "dreamfriday/ethereum"
 	models "dreamfriday/models"
 	pageengine "dreamfriday/pageengine"
 	utils "dreamfriday/utils"
 	"fmt"
+	"html"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
 )
 
+// LoginRateLimit is how many login challenges per second each client may request, set from LOGIN_RATE_LIMIT
+var LoginRateLimit rate.Limit = 2
+
+// EmailRateLimit is how often each client may request a magic link, set from EMAIL_RATE_LIMIT (per minute).
+// Every request sends an email, so clients get a burst of EmailRateBurst and then wait.
+var EmailRateLimit = rate.Every(20 * time.Second)
+
+const EmailRateBurst = 3
+
 // AuthHandler handles authentication operations
 type AuthHandler struct {
 	Authenticator auth.Authenticator
@@ -32,34 +47,159 @@ func (h *AuthHandler) GetHandle(c echo.Context) (string, error) {
 // Logout handler (calls `Authenticator.Logout`)
 func (h *AuthHandler) Logout(c echo.Context) error {
 	log.Println("Handling logout")
-	handle, _ := h.GetHandle(c)
-	cache.PreviewCache.Delete(handle)
-	cache.UserDataStore.Delete(handle)
+	clearUserCaches(c)
 	return h.Authenticator.Logout(c)
 }
 
 // AuthRequest handler (calls `EthAuthenticator.AuthRequestHandler`)
 func (h *AuthHandler) AuthRequest(c echo.Context) error {
-	return h.Authenticator.(*auth.EthAuthenticator).AuthRequestHandler(c)
+	authenticator, ok := ethAuthenticator()
+	if !ok {
+		return ethDisabled(c)
+	}
+	return authenticator.AuthRequestHandler(c)
 }
 
 // AuthCallback handler (calls `EthAuthenticator.AuthCallbackHandler`)
 func (h *AuthHandler) AuthCallback(c echo.Context) error {
+	authenticator, ok := ethAuthenticator()
+	if !ok {
+		return ethDisabled(c)
+	}
 	// delete user and preview cache if they switch sites on same peer
-	handle, _ := h.GetHandle(c)
-	cache.PreviewCache.Delete(handle)
+	clearUserCaches(c)
+	return authenticator.AuthCallbackHandler(c)
+}
+
+// ListProviders returns the names of the enabled login providers
+func (h *AuthHandler) ListProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string][]string{"providers": auth.Providers()})
+}
+
+// EmailRequest sends a magic link to the posted email address
+func (h *AuthHandler) EmailRequest(c echo.Context) error {
+	authenticator, ok := auth.GetProvider("email")
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Email login is not enabled"})
+	}
+	var request struct {
+		Email string `json:"email" form:"email"`
+	}
+	if err := c.Bind(&request); err != nil || request.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email is required"})
+	}
+	return authenticator.Login(c, request.Email, "")
+}
+
+// EmailCallback logs in with a magic link token
+func (h *AuthHandler) EmailCallback(c echo.Context) error {
+	authenticator, ok := auth.GetProvider("email")
+	if !ok {
+		return c.String(http.StatusNotFound, "Email login is not enabled")
+	}
+	clearUserCaches(c)
+	return authenticator.(*auth.EmailAuthenticator).CallbackHandler(c)
+}
+
+// OIDCLogin redirects to the OIDC provider
+func (h *AuthHandler) OIDCLogin(c echo.Context) error {
+	authenticator, ok := auth.GetProvider("oidc")
+	if !ok {
+		return c.String(http.StatusNotFound, "OIDC login is not enabled")
+	}
+	return authenticator.Login(c, "", "")
+}
+
+// OIDCCallback completes the OIDC authorization code flow
+func (h *AuthHandler) OIDCCallback(c echo.Context) error {
+	authenticator, ok := auth.GetProvider("oidc")
+	if !ok {
+		return c.String(http.StatusNotFound, "OIDC login is not enabled")
+	}
+	clearUserCaches(c)
+	return authenticator.(*auth.OIDCAuthenticator).CallbackHandler(c)
+}
+
+// passkeyAuthenticator returns the WebAuthn provider, if enabled
+func passkeyAuthenticator() (*auth.WebAuthnAuthenticator, bool) {
+	authenticator, ok := auth.GetProvider("webauthn")
+	if !ok {
+		return nil, false
+	}
+	return authenticator.(*auth.WebAuthnAuthenticator), true
+}
+
+func passkeysDisabled(c echo.Context) error {
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Passkey login is not enabled"})
+}
+
+// PasskeyRegisterBegin starts adding a passkey, to the current account or a new one
+func (h *AuthHandler) PasskeyRegisterBegin(c echo.Context) error {
+	authenticator, ok := passkeyAuthenticator()
+	if !ok {
+		return passkeysDisabled(c)
+	}
+	return authenticator.BeginRegistration(c)
+}
+
+// PasskeyRegisterFinish stores a newly created passkey
+func (h *AuthHandler) PasskeyRegisterFinish(c echo.Context) error {
+	authenticator, ok := passkeyAuthenticator()
+	if !ok {
+		return passkeysDisabled(c)
+	}
+	clearUserCaches(c)
+	return authenticator.FinishRegistration(c)
+}
+
+// PasskeyLoginBegin returns a passkey login challenge
+func (h *AuthHandler) PasskeyLoginBegin(c echo.Context) error {
+	authenticator, ok := passkeyAuthenticator()
+	if !ok {
+		return passkeysDisabled(c)
+	}
+	return authenticator.BeginLogin(c)
+}
+
+// PasskeyLoginFinish logs in with a signed passkey challenge
+func (h *AuthHandler) PasskeyLoginFinish(c echo.Context) error {
+	authenticator, ok := passkeyAuthenticator()
+	if !ok {
+		return passkeysDisabled(c)
+	}
+	clearUserCaches(c)
+	return authenticator.FinishLogin(c)
+}
+
+// LinkAccount makes the next login, with any provider, add an identity to the current user
+func (h *AuthHandler) LinkAccount(c echo.Context) error {
+	clearUserCaches(c)
+	return auth.StartLinking(c)
+}
+
+// ethAuthenticator returns the Ethereum provider, if enabled
+func ethAuthenticator() (*auth.EthAuthenticator, bool) {
+	authenticator, ok := auth.GetProvider("eth")
+	if !ok {
+		return nil, false
+	}
+	return authenticator.(*auth.EthAuthenticator), true
+}
+
+func ethDisabled(c echo.Context) error {
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Ethereum login is not enabled"})
+}
+
+func clearUserCaches(c echo.Context) {
+	handle, _ := auth.GetHandle(c)
+	clearPreviewCache(handle)
 	cache.UserDataStore.Delete(handle)
-	return h.Authenticator.(*auth.EthAuthenticator).AuthCallbackHandler(c)
 }
 
 func GetUserData(c echo.Context) (map[string]interface{}, error) {
 	log.Println("Getting user data")
-	session, err := auth.GetSession(c.Request())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get session")
-	}
-	handle, ok := session.Values["handle"].(string)
-	if !ok || handle == "" {
+	handle, err := auth.GetHandle(c)
+	if err != nil || handle == "" {
 		return nil, fmt.Errorf("user address not set or invalid in the session")
 	}
 
@@ -105,10 +245,13 @@ func GetUserData(c echo.Context) (map[string]interface{}, error) {
 		}
 	}
 
-	// Create a pageElement holding handle Span
+	// Create a pageElement holding handle Span, showing the ENS name when there is one
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+	defer cancel()
 	handleElement := pageengine.PageElement{
 		Type: "span",
-		Text: handle,
+		// span text is written as HTML, and ENS names are chosen by whoever owns them
+		Text: html.EscapeString(ethereum.DisplayName(ctx, handle)),
 	}
 
 	// Store data in map
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	cache "dreamfriday/cache"
+	pageengine "dreamfriday/pageengine"
+	"encoding/json"
+)
+
+// CacheCodecs returns the codecs used to store handler values in a shared cache backend
+func CacheCodecs() map[string]cache.Codec {
+	return map[string]cache.Codec{
+		"siteData": siteDataCodec{},
+		"preview":  previewDataCodec{},
+		"userData": userDataCodec{},
+		"render":   renderedPageCodec{},
+	}
+}
+
+// siteDataCodec stores pageengine.SiteData values
+type siteDataCodec struct{}
+
+func (siteDataCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (siteDataCodec) Decode(data []byte) (interface{}, error) {
+	var siteData pageengine.SiteData
+	err := json.Unmarshal(data, &siteData)
+	return siteData, err
+}
+
+// previewDataCodec stores *PreviewData. Only the site data is encoded; the pid map is
+// rebuilt from the pids written onto elements during the last preview render.
+type previewDataCodec struct{}
+
+func (previewDataCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value.(*PreviewData).SiteData)
+}
+
+func (previewDataCodec) Decode(data []byte) (interface{}, error) {
+	var siteData pageengine.SiteData
+	if err := json.Unmarshal(data, &siteData); err != nil {
+		return nil, err
+	}
+	previewData := &PreviewData{
+		SiteData:   &siteData,
+		PreviewMap: make(map[string]*pageengine.PageElement),
+	}
+	for name := range siteData.Pages {
+		page := siteData.Pages[name]
+		indexPids(page.Head.Elements, previewData.PreviewMap)
+		indexPids(page.Body.Elements, previewData.PreviewMap)
+	}
+	for _, component := range siteData.Components {
+		if component != nil {
+			if component.Pid != "" {
+				previewData.PreviewMap[component.Pid] = component
+			}
+			indexPids(component.Elements, previewData.PreviewMap)
+		}
+	}
+	return previewData, nil
+}
+
+func indexPids(elements []pageengine.PageElement, previewMap map[string]*pageengine.PageElement) {
+	for i := range elements {
+		if elements[i].Pid != "" {
+			previewMap[elements[i].Pid] = &elements[i]
+		}
+		indexPids(elements[i].Elements, previewMap)
+	}
+}
+
+// userDataCodec stores the map built by GetUserData, whose values are all PageElements
+type userDataCodec struct{}
+
+func (userDataCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (userDataCodec) Decode(data []byte) (interface{}, error) {
+	var elements map[string]pageengine.PageElement
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+	userData := make(map[string]interface{}, len(elements))
+	for key, element := range elements {
+		userData[key] = element
+	}
+	return userData, nil
+}
+
+// renderedPageCodec stores *RenderedPage values
+type renderedPageCodec struct{}
+
+func (renderedPageCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (renderedPageCodec) Decode(data []byte) (interface{}, error) {
+	var page RenderedPage
+	err := json.Unmarshal(data, &page)
+	return &page, err
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	auth "dreamfriday/auth"
+	cache "dreamfriday/cache"
+	models "dreamfriday/models"
+	pageengine "dreamfriday/pageengine"
+	utils "dreamfriday/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// matchRecord finds the collection record served at /<path>/<slug>, bound to the collection's template page
+func matchRecord(siteData *pageengine.SiteData, path string) (pageRender, bool) {
+	// the slug is the last segment, collection paths may have several
+	path = strings.Trim(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return pageRender{}, false
+	}
+	collectionPath, slug := path[:i], path[i+1:]
+	name, col := siteData.CollectionAt(collectionPath)
+	if col == nil {
+		return pageRender{}, false
+	}
+	record := col.Record(slug)
+	if record == nil {
+		return pageRender{}, false
+	}
+	pageData, ok := siteData.Pages[col.Template]
+	if !ok {
+		log.Printf("Template page %s of collection %s not found", col.Template, name)
+		return pageRender{}, false
+	}
+
+	log.Printf("Rendering %s record %s with page %s", name, slug, col.Template)
+	return pageRender{Name: col.Template, Page: pageData, Record: record, Status: http.StatusOK}, true
+}
+
+// GetCollection returns a published collection's records, in the collection's order
+func GetCollection(c echo.Context) error {
+	siteData, err := GetSiteData(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, "Site not found")
+	}
+	col, ok := siteData.Collections[c.Param("name")]
+	if !ok || col == nil {
+		return c.JSON(http.StatusNotFound, "Collection not found")
+	}
+	return c.JSON(http.StatusOK, col.Sorted())
+}
+
+// GetCollections returns every preview collection
+func (h *PreviewHandler) GetCollections(c echo.Context) error {
+	previewData, err := h.GetSiteData(c)
+	if err != nil {
+		log.Println("Failed to get preview data:", err)
+		return c.JSON(http.StatusInternalServerError, "Failed to get preview data")
+	}
+	return c.JSON(http.StatusOK, previewData.SiteData.Collections)
+}
+
+// GetRecord returns a record of a preview collection
+func (h *PreviewHandler) GetRecord(c echo.Context) error {
+	previewData, err := h.GetSiteData(c)
+	if err != nil {
+		log.Println("Failed to get preview data:", err)
+		return c.JSON(http.StatusInternalServerError, "Failed to get preview data")
+	}
+	col, ok := previewData.SiteData.Collections[c.Param("name")]
+	if !ok || col == nil {
+		return c.JSON(http.StatusNotFound, "Collection not found")
+	}
+	record := col.Record(c.Param("slug"))
+	if record == nil {
+		return c.JSON(http.StatusNotFound, "Record not found")
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// PutRecord creates or replaces a record of a preview collection from the posted JSON
+func (h *PreviewHandler) PutRecord(c echo.Context) error {
+	site, _, err := auth.AuthorizeSite(c, models.ActionEditPreview)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	previewData, err := h.GetSiteData(c)
+	if err != nil {
+		log.Println("Failed to get preview data:", err)
+		return c.JSON(http.StatusInternalServerError, "Failed to get preview data")
+	}
+	col, ok := previewData.SiteData.Collections[c.Param("name")]
+	if !ok || col == nil {
+		return c.JSON(http.StatusNotFound, "Collection not found")
+	}
+
+	var record pageengine.Record
+	if err := json.NewDecoder(c.Request().Body).Decode(&record); err != nil || record == nil {
+		return c.JSON(http.StatusBadRequest, "Invalid JSON")
+	}
+	record["slug"] = c.Param("slug")
+	if err := col.Validate(record); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	col.PutRecord(record)
+
+	if err := h.saveSiteData(c, site, previewData); err != nil {
+		return c.JSON(http.StatusInternalServerError, "Failed to update preview data")
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// DeleteRecord removes a record from a preview collection
+func (h *PreviewHandler) DeleteRecord(c echo.Context) error {
+	site, _, err := auth.AuthorizeSite(c, models.ActionEditPreview)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	previewData, err := h.GetSiteData(c)
+	if err != nil {
+		log.Println("Failed to get preview data:", err)
+		return c.JSON(http.StatusInternalServerError, "Failed to get preview data")
+	}
+	col, ok := previewData.SiteData.Collections[c.Param("name")]
+	if !ok || col == nil {
+		return c.JSON(http.StatusNotFound, "Collection not found")
+	}
+	if !col.DeleteRecord(c.Param("slug")) {
+		return c.JSON(http.StatusNotFound, "Record not found")
+	}
+
+	if err := h.saveSiteData(c, site, previewData); err != nil {
+		return c.JSON(http.StatusInternalServerError, "Failed to update preview data")
+	}
+	return c.JSON(http.StatusOK, "Record deleted")
+}
+
+// saveSiteData stores the user's preview collections in the site's draft, so records are kept
+// without a separate save and published with the rest of the site. Only the collections are
+// written: the rest of the cached preview has pids and may have edits the user hasn't saved.
+// The draft is re-read in the same transaction, so a publish or preview save since the site
+// was loaded isn't undone.
+func (h *PreviewHandler) saveSiteData(c echo.Context, site *models.Site, previewData *PreviewData) error {
+	collections, err := json.Marshal(previewData.SiteData.Collections)
+	if err != nil {
+		return err
+	}
+	saved, err := models.ModifySite(site.Name, func(site *models.Site) error {
+		draft := make(map[string]json.RawMessage)
+		if site.PreviewData != "" {
+			if err := json.Unmarshal([]byte(site.PreviewData), &draft); err != nil {
+				return err
+			}
+		}
+		draft["collections"] = collections
+		siteData, err := json.Marshal(draft)
+		if err != nil {
+			return err
+		}
+		site.PreviewData = string(siteData)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to update preview data for site %s: %v", site.Name, err)
+		return err
+	}
+
+	// other collaborators reload the draft, this user keeps editing theirs
+	clearSitePreviewCache(saved)
+	handle, _ := auth.GetHandle(c)
+	cache.PreviewCache.Set(previewCacheKey(handle, utils.GetSubdomain(c.Request().Host)), previewData)
+	return nil
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	auth "dreamfriday/auth"
+	models "dreamfriday/models"
+	pageengine "dreamfriday/pageengine"
+	utils "dreamfriday/utils"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dataSource resolves repeat sources: "data:<name>" from the site's data, "collection:<name>"
+// for a collection's records in order, or an internal data route
+func dataSource(c echo.Context, siteData *pageengine.SiteData) func(string) (interface{}, error) {
+	return func(source string) (interface{}, error) {
+		if name, ok := strings.CutPrefix(source, "collection:"); ok {
+			col, exists := siteData.Collections[name]
+			if !exists || col == nil {
+				return nil, fmt.Errorf("collection %s not found", name)
+			}
+			return col.Sorted(), nil
+		}
+		if name, ok := strings.CutPrefix(source, "data:"); ok {
+			data, exists := siteData.Data[name]
+			if !exists {
+				return nil, fmt.Errorf("site data %s not found", name)
+			}
+			return data, nil
+		}
+		return InternalData(source, c)
+	}
+}
+
+// InternalData serves internal routes as data for repeats, the counterpart of RouteInternal for components
+func InternalData(path string, c echo.Context) (interface{}, error) {
+	switch path {
+	case "/mysites":
+		handle, err := auth.GetHandle(c)
+		if err != nil || handle == "" {
+			return nil, fmt.Errorf("user address not set or invalid in the session")
+		}
+		user, err := models.GetUser(handle)
+		if err != nil {
+			return nil, err
+		}
+		sites := make([]map[string]string, len(user.Sites))
+		for i, site := range user.Sites {
+			sites[i] = map[string]string{
+				"name":   site,
+				"domain": utils.SiteDomain(site),
+				"url":    "https://" + utils.SiteDomain(site),
+			}
+		}
+		return sites, nil
+	default:
+		return nil, fmt.Errorf("unknown internal data route: %s", path)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	ethereum "dreamfriday/ethereum"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// ResolveRateLimit is how many /resolve requests per second each client may make, set from RESOLVE_RATE_LIMIT
+var ResolveRateLimit rate.Limit = 5
+
+// ResolveName looks up the handle (address) for an ENS name or address entered by a user
+func ResolveName(c echo.Context) error {
+	name := c.Param("name")
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	handle, err := ethereum.ResolveHandle(ctx, name)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"name": name, "address": handle})
+}
+
+// ReverseName returns the primary ENS name for an address, or the address if it has none
+func ReverseName(c echo.Context) error {
+	address := c.Param("address")
+	if !common.IsHexAddress(address) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid address"})
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	return c.JSON(http.StatusOK, map[string]string{"address": address, "name": ethereum.DisplayName(ctx, address)})
+}
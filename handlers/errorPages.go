@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	pageengine "dreamfriday/pageengine"
+
+	"github.com/labstack/echo/v4"
+)
+
+// built in page for errors a site has no page for, or that happen before its site data loads
+const fallbackHTML = `<!DOCTYPE html><html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>%d %s</title>` +
+	`<style>body{font-family:sans-serif;display:flex;flex-direction:column;align-items:center;justify-content:center;height:100vh;margin:0;color:#333}h1{font-size:4rem;margin:0}</style>` +
+	`</head><body><h1>%d</h1><p>%s</p></body></html>`
+
+// ErrorFallback answers with the built in error page, or plain text for clients that don't want HTML
+func ErrorFallback(c echo.Context, status int, message string) error {
+	if !strings.Contains(c.Request().Header.Get("Accept"), "text/html") {
+		return c.String(status, message)
+	}
+	return c.HTML(status, fmt.Sprintf(fallbackHTML, status, http.StatusText(status), status, html.EscapeString(message)))
+}
+
+// renderStatusPage renders the site's own page for an error status (404, 500 or maintenance),
+// falling back to the built in page when the site doesn't define one
+func renderStatusPage(c echo.Context, siteData *pageengine.SiteData, pageName string, status int, message string) error {
+	if siteData != nil {
+		if pageData, ok := siteData.Pages[pageName]; ok {
+			log.Printf("Rendering %s page with status %d", pageName, status)
+			return renderPage(c, siteData, pageRender{Name: pageName, Page: pageData, Status: status})
+		}
+	}
+	return ErrorFallback(c, status, message)
+}
+
+// renderFailed answers a page that failed to render with the site's 500 page, or the built in one
+// when the 500 page is what failed
+func renderFailed(c echo.Context, siteData *pageengine.SiteData, r pageRender) error {
+	if r.Name == pageengine.ErrorPage {
+		return ErrorFallback(c, http.StatusInternalServerError, "Something went wrong")
+	}
+	return renderStatusPage(c, siteData, pageengine.ErrorPage, http.StatusInternalServerError, "Something went wrong")
+}
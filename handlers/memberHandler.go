@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"dreamfriday/auth"
+	cache "dreamfriday/cache"
+	ethereum "dreamfriday/ethereum"
+	models "dreamfriday/models"
+	utils "dreamfriday/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListMembers returns the site's owner and collaborators
+func ListMembers(c echo.Context) error {
+	site, _, err := auth.AuthorizeSite(c, models.ActionViewPreview)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	members := site.Members
+	if members == nil {
+		members = []models.Member{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"owner":   site.Owner,
+		"members": members,
+	})
+}
+
+// InviteMember invites an address (or ENS name) to the site with a role, or changes a member's role
+func InviteMember(c echo.Context) error {
+	site, handle, err := auth.AuthorizeSite(c, models.ActionManageMembers)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	var request struct {
+		Address string `json:"address" form:"address"`
+		Role    string `json:"role" form:"role"`
+	}
+	if err := c.Bind(&request); err != nil || strings.TrimSpace(request.Address) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "address and role are required"})
+	}
+
+	// handles of accounts without a wallet are used as is, anything else must be an address or an ENS name
+	invitee := strings.TrimSpace(request.Address)
+	if !nonWalletHandle(invitee) {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+		defer cancel()
+		resolved, err := ethereum.ResolveHandle(ctx, invitee)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		invitee = resolved
+	}
+
+	member, err := models.InviteMember(site.Name, invitee, request.Role, handle)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	cache.PreviewCache.Delete(previewCacheKey(invitee, site.Name))
+	return c.JSON(http.StatusOK, member)
+}
+
+// handle prefixes of accounts created by logging in without a wallet
+var nonWalletPrefixes = []string{"email:", "oidc:", "passkey:"}
+
+func nonWalletHandle(handle string) bool {
+	for _, prefix := range nonWalletPrefixes {
+		if strings.HasPrefix(handle, prefix) && len(handle) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptInvitation accepts the current user's invitation to the request's site
+func AcceptInvitation(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	siteName := utils.GetSubdomain(c.Request().Host)
+	member, err := models.AcceptInvitation(siteName, handle)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	cache.UserDataStore.Delete(handle)
+	return c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember removes a collaborator. Owners can remove anyone, members can remove themselves.
+func RemoveMember(c echo.Context) error {
+	member := c.Param("handle")
+	site, handle, err := auth.AuthorizeSite(c, models.ActionManageMembers)
+	if err != nil && (handle == "" || handle != member) {
+		return auth.AccessDenied(c, err)
+	}
+	siteName := utils.GetSubdomain(c.Request().Host)
+	if site != nil {
+		siteName = site.Name
+	}
+
+	if err := models.RemoveMember(siteName, member); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	cache.PreviewCache.Delete(previewCacheKey(member, siteName))
+	cache.UserDataStore.Delete(member)
+	log.Printf("%s removed %s from %s", handle, member, siteName)
+	return c.JSON(http.StatusOK, map[string]string{"status": "removed"})
+}
@@ -1,42 +1,73 @@
 package handlers
 
 import (
+	"bytes"
 	auth "dreamfriday/auth"
 	cache "dreamfriday/cache"
+	models "dreamfriday/models"
 	PageEngine "dreamfriday/pageengine"
 	pageengine "dreamfriday/pageengine"
+	utils "dreamfriday/utils"
 	"log"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 )
 
+// pageRender is a page to render for a request, and what it is bound to
+type pageRender struct {
+	Name   string
+	Page   pageengine.Page
+	Record pageengine.Record // collection record, for template pages
+	Params map[string]string // captured by the page's path pattern
+	Status int
+}
+
+// RenderPage renders the page matching the request path: a page named by the path,
+// a collection record, a page whose path pattern matches, or else the site's 404 page
 func RenderPage(c echo.Context) error {
-	pageName := c.Param("pageName")
-	if pageName == "" {
-		pageName = "home"
-	}
-	log.Printf("Page requested: %s\n", pageName)
+	path := c.Request().URL.Path
+	log.Printf("Page requested: %s\n", path)
 
 	rawSiteData := c.Get("siteData")
 	if rawSiteData == nil {
 		log.Println("Site data is nil in context")
-		return c.String(http.StatusInternalServerError, "Site data is nil")
+		return ErrorFallback(c, http.StatusInternalServerError, "Site data is nil")
 	}
 
 	// Perform type assertion
 	siteData, ok := rawSiteData.(*pageengine.SiteData)
 	if !ok || siteData == nil {
 		log.Println("Site data type assertion failed or is nil")
-		return c.String(http.StatusInternalServerError, "Site data is invalid")
+		return ErrorFallback(c, http.StatusInternalServerError, "Site data is invalid")
 	}
 
-	pageData, ok := siteData.Pages[pageName]
-	if !ok {
-		log.Println("Page not found in site data")
-		return c.String(http.StatusNotFound, "Page not found")
+	// during maintenance only collaborators see the site
+	if siteData.Maintenance {
+		if _, _, err := auth.AuthorizeSite(c, models.ActionViewPreview); err != nil {
+			return renderStatusPage(c, siteData, pageengine.MaintenancePage, http.StatusServiceUnavailable, "This site is down for maintenance")
+		}
 	}
 
+	pageName, params, found := siteData.MatchPage(path)
+	// pages named by the path come first, then records, then path patterns (which capture params)
+	if found && params == nil {
+		return renderPage(c, siteData, pageRender{Name: pageName, Page: siteData.Pages[pageName], Status: http.StatusOK})
+	}
+	if r, ok := matchRecord(siteData, path); ok {
+		return renderPage(c, siteData, r)
+	}
+	if found {
+		return renderPage(c, siteData, pageRender{Name: pageName, Page: siteData.Pages[pageName], Params: params, Status: http.StatusOK})
+	}
+
+	log.Println("Page not found in site data:", path)
+	return renderStatusPage(c, siteData, pageengine.NotFoundPage, http.StatusNotFound, "Page not found")
+}
+
+// renderPage renders a page of the site with the request's status
+func renderPage(c echo.Context, siteData *pageengine.SiteData, r pageRender) error {
+	pageName, pageData, record := r.Name, r.Page, r.Record
 	loggedIn := auth.IsAuthenticated(c)
 	log.Printf("Rendering page: %s (Logged in: %v)\n", pageName, loggedIn)
 
@@ -55,6 +86,19 @@ func RenderPage(c echo.Context) error {
 		}
 	}
 
+	// token gated pages redirect, or show their fallback, to viewers who don't hold enough of the token
+	if !previewEnabled && !viewerPassesGate(c, pageData.Gate) {
+		gate := pageData.Gate
+		if gate.Redirect != "" {
+			log.Println("Token gate failed, redirecting to:", gate.Redirect)
+			return c.Redirect(http.StatusFound, gate.Redirect)
+		}
+		if gate.Fallback == nil {
+			return ErrorFallback(c, http.StatusForbidden, "This page is only available to token holders")
+		}
+		pageData.Body.Elements = []pageengine.PageElement{*gate.Fallback}
+	}
+
 	components := siteData.Components
 
 	// Retrieve session
@@ -62,33 +106,76 @@ func RenderPage(c echo.Context) error {
 
 	if previewEnabled && err == nil {
 		// Retrieve PreviewData from previewDataStore
-		if previewDataIface, found := cache.PreviewCache.Get(handle); found {
+		cacheKey := previewCacheKey(handle, utils.GetSubdomain(c.Request().Host))
+		if previewDataIface, found := cache.PreviewCache.Get(cacheKey); found {
 			if previewData, ok := previewDataIface.(*PreviewData); ok {
 				log.Println("Passing previewMap to renderPage")
 
+				// pids are reassigned on every render, so drop the previous render's entries
+				clear(previewData.PreviewMap)
+
 				// Render with preview map
-				c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
-				pageengine := PageEngine.NewPageEngine(c, components)
+				var buf bytes.Buffer
+				pageengine := PageEngine.NewPageEngineWriter(c, components, &buf)
+				pageengine.SetGateChecker(gateChecker(c, true))
+				pageengine.SetRenderContext(newRenderContext(c, r, true))
+				pageengine.SetMarkdownCache(cache.MarkdownCache)
+				pageengine.SetDataSource(dataSource(c, siteData))
+				if record != nil {
+					pageengine.SetRecord(record)
+				}
 				if err := pageengine.RenderPage(pageData, RouteInternal, previewData.PreviewMap); err != nil {
 					log.Println("Unable to render page with preview data:", err)
-					return c.String(http.StatusInternalServerError, err.Error())
+					return renderFailed(c, siteData, r)
 				}
-				return nil
+				// store the new pids so element edits work on any instance sharing the cache
+				cache.PreviewCache.Set(cacheKey, previewData)
+				return c.HTMLBlob(r.Status, buf.Bytes())
 			}
 		}
 	}
 
 	log.Println("Not passing previewMap to renderPage")
 
-	// Render without preview map
-	c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+	// production pages that render the same for everyone are served from the render cache
+	if !previewEnabled && r.Status == http.StatusOK && siteData.IPFSHash != "" && isCacheablePage(pageData, components) {
+		return renderCachedPage(c, siteData, r)
+	}
 
-	pageengine := PageEngine.NewPageEngine(c, components)
+	// Render without preview map
+	var buf bytes.Buffer
+	pageengine := PageEngine.NewPageEngineWriter(c, components, &buf)
+	pageengine.SetGateChecker(gateChecker(c, false))
+	pageengine.SetRenderContext(newRenderContext(c, r, false))
+	pageengine.SetMarkdownCache(cache.MarkdownCache)
+	pageengine.SetDataSource(dataSource(c, siteData))
+	if record != nil {
+		pageengine.SetRecord(record)
+	}
 
 	if err := pageengine.RenderPage(pageData, RouteInternal, nil); err != nil {
 		log.Println("Unable to render page:", err)
-		return c.String(http.StatusInternalServerError, err.Error())
+		return renderFailed(c, siteData, r)
 	}
 
-	return nil
+	return c.HTMLBlob(r.Status, buf.Bytes())
+}
+
+// newRenderContext describes the request for if/unless conditions
+func newRenderContext(c echo.Context, r pageRender, previewEnabled bool) *pageengine.RenderContext {
+	rc := &pageengine.RenderContext{
+		LoggedIn: auth.IsAuthenticated(c),
+		Preview:  previewEnabled,
+		Page:     r.Name,
+		Query:    c.QueryParams(),
+		Params:   r.Params,
+	}
+	if rc.LoggedIn {
+		if handle, err := auth.GetHandle(c); err == nil {
+			if site, err := models.GetSite(utils.GetSubdomain(c.Request().Host)); err == nil {
+				rc.Owner = site.RoleOf(handle) == models.RoleOwner
+			}
+		}
+	}
+	return rc
 }
@@ -19,6 +19,13 @@ import (
 type PreviewData struct {
 	SiteData   *pageengine.SiteData
 	PreviewMap map[string]*pageengine.PageElement
+	size       int64 // length of the draft JSON it was loaded from
+}
+
+// CacheSize lets the preview cache count the draft's size instead of encoding the
+// whole site on every Set. Edits since it was loaded don't change the estimate.
+func (p *PreviewData) CacheSize() int64 {
+	return p.size
 }
 
 type PreviewHandler struct {
@@ -35,13 +42,13 @@ func (h *PreviewHandler) GetSiteData(c echo.Context) (*PreviewData, error) {
 
 	log.Println("--> Fetching preview data for site:", siteName)
 
-	handle, err := auth.GetHandle(c)
+	site, handle, err := auth.AuthorizeSite(c, models.ActionViewPreview)
 	if err != nil {
-		log.Println("Failed to get handle:", err)
-		return nil, fmt.Errorf("failed to get handle")
+		log.Println("Not allowed to view preview:", err)
+		return nil, err
 	}
 
-	if previewDataIface, found := cache.PreviewCache.Get(handle); found {
+	if previewDataIface, found := cache.PreviewCache.Get(previewCacheKey(handle, siteName)); found {
 		if previewData, ok := previewDataIface.(*PreviewData); ok {
 			log.Println("Serving cached preview data for handle:", handle)
 			return previewData, nil
@@ -51,13 +58,6 @@ func (h *PreviewHandler) GetSiteData(c echo.Context) (*PreviewData, error) {
 
 	log.Println("Preview data not found in cache, fetching from database for site:", siteName)
 
-	// Fetch preview data from database
-	site, err := models.GetSite(siteName)
-	if err != nil {
-		log.Printf("Failed to get site %s: %v", siteName, err)
-		return nil, err
-	}
-
 	var previewSiteData pageengine.SiteData
 
 	// Unmarshal the JSON data into the previewData struct
@@ -71,31 +71,52 @@ func (h *PreviewHandler) GetSiteData(c echo.Context) (*PreviewData, error) {
 	newPreviewData := &PreviewData{
 		SiteData:   &previewSiteData,
 		PreviewMap: make(map[string]*pageengine.PageElement),
+		size:       int64(len(site.PreviewData)),
 	}
 
 	// Store fetched PreviewData in sync.Map
-	cache.PreviewCache.Set(handle, newPreviewData)
+	cache.PreviewCache.Set(previewCacheKey(handle, siteName), newPreviewData)
 
 	log.Println("Cached preview data for handle:", handle)
 
 	return newPreviewData, nil
 }
 
+// previewCacheKey scopes a user's cached preview data to one site
+func previewCacheKey(handle, siteName string) string {
+	return handle + "|" + siteName
+}
+
+// clearPreviewCache drops a user's cached preview data for all of their sites
+func clearPreviewCache(handle string) {
+	if handle == "" {
+		return
+	}
+	user, err := models.GetUser(handle)
+	if err != nil {
+		return
+	}
+	for _, siteName := range user.Sites {
+		cache.PreviewCache.Delete(previewCacheKey(handle, siteName))
+	}
+}
+
+// clearSitePreviewCache drops every collaborator's cached preview data for a site
+func clearSitePreviewCache(site *models.Site) {
+	cache.PreviewCache.Delete(previewCacheKey(site.Owner, site.Name))
+	for _, member := range site.Members {
+		cache.PreviewCache.Delete(previewCacheKey(member.Handle, site.Name))
+	}
+}
+
 // func (h *PreviewHandler) GetPage(c echo.Context) error {
 // 	return nil
 // }
 
 func (h *PreviewHandler) Update(c echo.Context) error {
-	// Retrieve the session
-	session, err := auth.GetSession(c.Request())
-	if err != nil {
-		log.Println("Failed to get session:", err)
-		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
-	}
-
-	// Get user handle from session
-	handle, ok := session.Values["handle"].(string)
-	if !ok || handle == "" {
+	// Get user handle from the session or API token
+	handle, err := auth.GetHandle(c)
+	if err != nil || handle == "" {
 		log.Println("Unauthorized: handle not found in session")
 		return c.String(http.StatusUnauthorized, "Unauthorized: No valid identifier found")
 	}
@@ -118,25 +139,24 @@ func (h *PreviewHandler) Update(c echo.Context) error {
 		log.Printf("Failed to unmarshal site data for domain %s: %v", siteName, err)
 		return c.String(http.StatusBadRequest, "Invalid JSON data")
 	}
+	if err := parsedPreviewData.ValidatePages(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err := parsedPreviewData.ValidateCollections(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 
 	// Save preview data to the database and mark as "unpublished"
-	site, err := models.GetSite(siteName)
+	site, _, err := auth.AuthorizeSite(c, models.ActionEditPreview)
 	if err != nil {
-		log.Printf("Failed to get site %s: %v", siteName, err)
-		return c.String(http.StatusInternalServerError, "Failed to get site")
-	}
-	if site == nil {
-		log.Printf("Site %s not found", siteName)
-		return c.String(http.StatusNotFound, "Site not found")
-	}
-	// check ownership
-	if site.Owner != handle {
-		log.Printf("Unauthorized: %s is not the owner of site %s", handle, siteName)
-		return c.String(http.StatusUnauthorized, "Unauthorized: You are not the owner of this site")
+		return auth.AccessDenied(c, err)
 	}
-	site.PreviewData = previewData
 
-	err = models.UpdateSite(siteName, site)
+	// only the preview data changes, members, status and the published CID are kept as they are now
+	site, err = models.ModifySite(site.Name, func(site *models.Site) error {
+		site.PreviewData = previewData
+		return nil
+	})
 	if err != nil {
 		log.Printf("Failed to update preview data for site %s: %v", siteName, err)
 		return c.String(http.StatusInternalServerError, "Failed to update preview data")
@@ -144,8 +164,8 @@ func (h *PreviewHandler) Update(c echo.Context) error {
 
 	log.Printf("Successfully updated preview data for site: %s (Status: unpublished)", siteName)
 
-	// purge handle -> domain from previewDataStore
-	cache.PreviewCache.Delete(handle)
+	// purge handle -> domain from previewDataStore, for every collaborator
+	clearSitePreviewCache(site)
 
 	// Return success response
 	// return c.Render(http.StatusOK, "manageButtons.html", map[string]interface{}{
@@ -160,7 +180,7 @@ func (h *PreviewHandler) Update(c echo.Context) error {
 // return element found anywhere in previewData based on pid
 
 func (h *PreviewHandler) IsPreviewEnabled(c echo.Context) (bool, error) {
-	session, err := auth.GetSession(c.Request())
+	session, err := auth.Session(c)
 	if err != nil {
 		log.Println("Failed to retrieve session:", err)
 		return false, fmt.Errorf("failed to retrieve session: %s - are you logged in?", err.Error())
@@ -177,7 +197,7 @@ func (h *PreviewHandler) IsPreviewEnabled(c echo.Context) (bool, error) {
 func (h *PreviewHandler) SetPreview(c echo.Context, preview bool) error {
 	siteName := utils.GetSubdomain(c.Request().Host)
 
-	session, err := auth.GetSession(c.Request())
+	session, err := auth.Session(c)
 	if err != nil {
 		log.Println("Failed to retrieve session:", err)
 		return fmt.Errorf("failed to retrieve session")
@@ -321,7 +341,7 @@ func (h *PreviewHandler) DeletePreviewCache(c echo.Context) error {
 		return err
 	}
 	// Delete user data from cache
-	cache.PreviewCache.Delete(handle)
+	cache.PreviewCache.Delete(previewCacheKey(handle, utils.GetSubdomain(c.Request().Host)))
 	log.Println("Deleted preview cache for handle:", handle)
 	return nil
 }
@@ -337,16 +357,11 @@ func (h *PreviewHandler) GetElement(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, "Element ID is required")
 	}
 	log.Println("Getting preview element:", pid)
-	// get handle from session
-	session, err := auth.GetSession(c.Request())
-	if err != nil {
-		log.Println("Failed to get session:", err)
-		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
-	}
-	handle, ok := session.Values["handle"].(string)
-	if ok && handle != "" {
+	// get handle from the session or API token
+	_, handle, err := auth.AuthorizeSite(c, models.ActionViewPreview)
+	if err == nil && handle != "" {
 		// load preview data from previewDataStore by handle -> domain -> previewData:
-		if userPreviewData, found := cache.PreviewCache.Get(handle); found {
+		if userPreviewData, found := cache.PreviewCache.Get(previewCacheKey(handle, utils.GetSubdomain(c.Request().Host))); found {
 			if previewData, ok := userPreviewData.(*PreviewData); ok {
 				if element, found := previewData.PreviewMap[pid]; found {
 					log.Println("Element found in preview data:", pid)
@@ -378,20 +393,15 @@ func (h *PreviewHandler) UpdateElement(c echo.Context) error {
 
 	log.Println("Updating preview element:", pid)
 
-	// Retrieve session
-	session, err := auth.GetSession(c.Request())
+	// Retrieve handle from the session or API token
+	_, handle, err := auth.AuthorizeSite(c, models.ActionEditPreview)
 	if err != nil {
-		log.Println("Failed to get session:", err)
-		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
-	}
-
-	handle, ok := session.Values["handle"].(string)
-	if !ok || handle == "" {
-		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+		return auth.AccessDenied(c, err)
 	}
 
 	// Retrieve user's preview data from cache
-	userPreviewData, found := cache.PreviewCache.Get(handle)
+	cacheKey := previewCacheKey(handle, utils.GetSubdomain(c.Request().Host))
+	userPreviewData, found := cache.PreviewCache.Get(cacheKey)
 	if !found {
 		return c.JSON(http.StatusUnauthorized, "Unauthorized")
 	}
@@ -421,7 +431,7 @@ func (h *PreviewHandler) UpdateElement(c echo.Context) error {
 	log.Println("Updating element:", *existingElement)
 
 	// Optionally, if your cache requires an explicit Set to persist the changes:
-	cache.PreviewCache.Set(handle, previewData)
+	cache.PreviewCache.Set(cacheKey, previewData)
 
 	return c.JSON(http.StatusOK, existingElement)
 }
@@ -431,18 +441,16 @@ func (h *PreviewHandler) UpdatePage(c echo.Context) error {
 	if pageName == "" {
 		return c.JSON(http.StatusBadRequest, "Page name is required")
 	}
+	_, handle, err := auth.AuthorizeSite(c, models.ActionEditPreview)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
 	previewData, err := h.GetSiteData(c)
 	if err != nil {
 		log.Println("Failed to get preview data:", err)
 		return c.JSON(http.StatusInternalServerError, "Failed to get preview data")
 	}
 
-	handle, err := auth.GetHandle(c)
-	if err != nil {
-		log.Println("Failed to get handle:", err)
-		return c.JSON(http.StatusInternalServerError, "Failed to get handle")
-	}
-
 	// check if page exists
 	_, ok := previewData.SiteData.Pages[pageName]
 
@@ -458,7 +466,7 @@ func (h *PreviewHandler) UpdatePage(c echo.Context) error {
 
 	previewData.SiteData.Pages[pageName] = updatedPage
 
-	cache.PreviewCache.Set(handle, previewData)
+	cache.PreviewCache.Set(previewCacheKey(handle, utils.GetSubdomain(c.Request().Host)), previewData)
 
 	return c.JSON(http.StatusOK, previewData)
 }
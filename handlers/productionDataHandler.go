@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	ipfs "dreamfriday/IPFS"
 	auth "dreamfriday/auth"
 	cache "dreamfriday/cache"
+	ethereum "dreamfriday/ethereum"
 	models "dreamfriday/models"
 	pageengine "dreamfriday/pageengine"
 	utils "dreamfriday/utils"
 
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,7 +24,7 @@ func GetSiteData(c echo.Context) (*pageengine.SiteData, error) {
 	siteName := utils.GetSubdomain(c.Request().Host)
 
 	if cachedData, found := cache.SiteDataStore.Get(siteName); found {
-		if siteData, ok := cachedData.(pageengine.SiteData); ok {
+		if siteData, ok := cachedData.(pageengine.SiteData); ok && registryCIDCurrent(siteName, siteData.IPFSHash) {
 			log.Println("Serving cached site data for site:", siteName)
 			c.Set("siteData", siteData)
 			return &siteData, nil
@@ -52,17 +55,58 @@ func GetSiteData(c echo.Context) (*pageengine.SiteData, error) {
 	return &siteData, nil
 
 }
-func CreateSite(c echo.Context) error {
-	// Retrieve the session
-	session, err := auth.GetSession(c.Request())
+
+// registryCIDCurrent reports whether cached data loaded from cid is still what the site registry points to
+func registryCIDCurrent(siteName, cid string) bool {
+	if ethereum.SiteCIDs == nil {
+		return true
+	}
+	site, err := models.GetSite(siteName)
 	if err != nil {
-		log.Println("Failed to get session:", err)
-		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
+		return true
+	}
+	return models.ServedCID(site) == cid
+}
+
+// WarmSiteDataCache loads every site in bolt into SiteDataStore, preferring the
+// persisted snapshot and only falling back to IPFS when no snapshot exists
+func WarmSiteDataCache() {
+	sites, err := models.ListSites()
+	if err != nil {
+		log.Println("Failed to list sites for cache warmup:", err)
+		return
+	}
+
+	warmed := 0
+	for _, site := range sites {
+		if site.Status == models.SiteStatusDeleted {
+			continue
+		}
+		siteDataJSON, err := models.GetSiteDataFromSnapshot(site.Name)
+		if err != nil {
+			log.Printf("No snapshot for site %s, fetching from IPFS: %v", site.Name, err)
+			siteDataJSON, err = models.GetSiteData(site.Name)
+			if err != nil {
+				log.Printf("Failed to warm cache for site %s: %v", site.Name, err)
+				continue
+			}
+		}
+
+		var siteData pageengine.SiteData
+		if err := json.Unmarshal([]byte(siteDataJSON), &siteData); err != nil {
+			log.Printf("Failed to unmarshal site data for site %s: %v", site.Name, err)
+			continue
+		}
+		cache.SiteDataStore.Set(site.Name, siteData)
+		warmed++
 	}
+	log.Printf("Warmed site data cache for %d of %d sites", warmed, len(sites))
+}
 
+func CreateSite(c echo.Context) error {
 	// Get handle from session (if present)
-	handle, ok := session.Values["handle"].(string)
-	if !ok || handle == "" {
+	handle, err := auth.GetHandle(c)
+	if err != nil || handle == "" {
 		log.Println("Unauthorized: handle not found in session")
 		return c.String(http.StatusUnauthorized, "Unauthorized: No valid identifier found")
 	}
@@ -142,16 +186,9 @@ func CreateSite(c echo.Context) error {
 	return c.HTML(http.StatusOK, `<script>window.location.href = 'https://`+utils.SiteDomain(siteName)+`/manage'</script>`)
 }
 func PublishSite(c echo.Context) error {
-	// Retrieve the session
-	session, err := auth.GetSession(c.Request())
-	if err != nil {
-		log.Println("Failed to get session:", err)
-		return c.String(http.StatusInternalServerError, "Failed to retrieve session")
-	}
-
-	// Get user email from session
-	handle, ok := session.Values["handle"].(string)
-	if !ok || handle == "" {
+	// Get handle from the session or API token
+	handle, err := auth.GetHandle(c)
+	if err != nil || handle == "" {
 		log.Println("Unauthorized: Email not found in session")
 		return c.String(http.StatusUnauthorized, "Unauthorized")
 	}
@@ -165,19 +202,40 @@ func PublishSite(c echo.Context) error {
 	}
 
 	log.Printf("Publishing Domain: %s for Email: %s", domain, handle)
-	// Attempt to publish the site
-	site, err := models.GetSite(domain)
+	// Attempt to publish the site, if the user's role allows it
+	site, _, err := auth.AuthorizeSite(c, models.ActionPublish)
 	if err != nil {
-		log.Printf("Failed to get site %s: %v", domain, err)
-		return c.String(http.StatusBadRequest, "Failed to get site")
+		return auth.AccessDenied(c, err)
 	}
 
-	// confirm ownership
-	if site.Owner != handle {
-		log.Printf("Unauthorized: %s is not the owner of %s", handle, domain)
-		return c.String(http.StatusUnauthorized, "Unauthorized")
+	// the publishing user's wallet must have signed a manifest for exactly this preview data
+	var manifest models.PublishManifest
+	if err := c.Bind(&manifest); err != nil || manifest.Signature == "" {
+		return c.String(http.StatusBadRequest, "A signed publish manifest is required, see /publish/manifest")
+	}
+	if manifest.Site != site.Name {
+		return c.String(http.StatusBadRequest, "Manifest is for another site")
+	}
+	if manifest.PreviousCID != site.IPFSHash {
+		return c.String(http.StatusConflict, "Site was published since the manifest was signed")
+	}
+	cid, err := ipfs.HashFile(site.PreviewData)
+	if err != nil {
+		log.Printf("Failed to hash preview data for %s: %v", domain, err)
+		return c.String(http.StatusInternalServerError, "Failed to publish site")
+	}
+	if manifest.CID != cid {
+		return c.String(http.StatusConflict, "Preview data changed since the manifest was signed")
+	}
+	if err := auth.VerifyManifest(&manifest, handle); err != nil {
+		log.Printf("Rejected publish manifest for %s from %s: %v", domain, handle, err)
+		return c.String(http.StatusUnauthorized, "Invalid publish manifest: "+err.Error())
+	}
+
+	err = models.PublishSite(site, &manifest, handle)
+	if errors.Is(err, models.ErrPublishConflict) {
+		return c.String(http.StatusConflict, "Site was published since the manifest was signed")
 	}
-	err = models.PublishSite(site)
 	if err != nil {
 		log.Printf("Failed to publish domain %s for email %s: %v", domain, handle, err)
 		return c.String(http.StatusInternalServerError, "Failed to publish site")
@@ -192,6 +250,52 @@ func PublishSite(c echo.Context) error {
 	// Return success response
 	return c.String(http.StatusOK, "Site published successfully")
 }
+
+// GetPublishManifest returns the manifest to sign for publishing the site's current preview data
+func GetPublishManifest(c echo.Context) error {
+	site, _, err := auth.AuthorizeSite(c, models.ActionPublish)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	cid, err := ipfs.HashFile(site.PreviewData)
+	if err != nil {
+		log.Printf("Failed to hash preview data for %s: %v", site.Name, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to hash preview data"})
+	}
+	manifest := auth.NewManifest(site, cid)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"manifest": manifest,
+		"message":  manifest.Message(),
+	})
+}
+
+// ListVersions returns the site's signed publish history, newest first, so anyone can audit it
+func ListVersions(c echo.Context) error {
+	siteName := utils.GetSubdomain(c.Request().Host)
+	site, err := models.GetSite(siteName)
+	if err != nil || site.Status == models.SiteStatusDeleted {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Site not found"})
+	}
+	versions, err := models.ListSiteVersions(siteName)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	type auditedVersion struct {
+		models.SiteVersion
+		Message string `json:"message"` // what the signer signed
+	}
+	history := make([]auditedVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		history = append(history, auditedVersion{versions[i], versions[i].Message()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"site":     siteName,
+		"cid":      site.IPFSHash,
+		"versions": history,
+	})
+}
+
 func GetPage(c echo.Context) error {
 	siteName := utils.GetSubdomain(c.Request().Host)
 	pageName := c.Param("pageName")
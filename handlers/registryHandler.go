@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"dreamfriday/auth"
+	ethereum "dreamfriday/ethereum"
+	models "dreamfriday/models"
+	utils "dreamfriday/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/labstack/echo/v4"
+)
+
+func registryDisabled(c echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "site registry is not configured"})
+}
+
+// GetRegistryTx returns the setSite call recording the site's published CID, for the owner's wallet to sign
+func GetRegistryTx(c echo.Context) error {
+	if ethereum.Registry == nil || ethereum.Writer == nil {
+		return registryDisabled(c)
+	}
+	site, _, err := auth.AuthorizeSite(c, models.ActionPublish)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+	chainID, err := ethereum.Writer.ChainID(ctx)
+	if err != nil {
+		log.Println("Failed to get chain id:", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "chain unavailable"})
+	}
+	fee, err := ethereum.Registry.CreationFee(ctx)
+	if err != nil {
+		log.Println("Failed to get registry fee:", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "chain unavailable"})
+	}
+	data, err := ethereum.PackSetSite(site.Name, site.IPFSHash)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"site":    site.Name,
+		"cid":     site.IPFSHash,
+		"chainId": hexutil.EncodeBig(chainID),
+		"to":      ethereum.Registry.Address.Hex(),
+		"value":   hexutil.EncodeBig(fee),
+		"data":    hexutil.Encode(data),
+	})
+}
+
+// RelayRegistryTx broadcasts a setSite transaction the user signed for the site's published CID
+func RelayRegistryTx(c echo.Context) error {
+	if ethereum.Registry == nil || ethereum.Writer == nil {
+		return registryDisabled(c)
+	}
+	site, handle, err := auth.AuthorizeSite(c, models.ActionPublish)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+
+	rawTx, err := hexutil.Decode(strings.TrimSpace(c.FormValue("tx")))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tx must be a 0x prefixed signed transaction"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+	// the transaction must come from the wallet behind the user's handle
+	address, err := ethereum.ResolveHandle(ctx, handle)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "publishing to the registry needs a wallet login"})
+	}
+
+	tx, err := ethereum.RelaySetSite(ctx, rawTx, site.Name, site.IPFSHash, common.HexToAddress(address))
+	if err != nil {
+		log.Printf("Rejected registry transaction for %s from %s: %v", site.Name, handle, err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"site":   site.Name,
+		"cid":    site.IPFSHash,
+		"txHash": tx.Hash().Hex(),
+	})
+}
+
+// VerifySite checks the CID the site is served from against the registry
+func VerifySite(c echo.Context) error {
+	if ethereum.Registry == nil {
+		return registryDisabled(c)
+	}
+	siteName := utils.GetSubdomain(c.Request().Host)
+	siteData, err := GetSiteData(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Site not found"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+	verification, err := ethereum.VerifySite(ctx, siteName, siteData.IPFSHash)
+	if err != nil {
+		log.Printf("Failed to verify site %s: %v", siteName, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "chain unavailable"})
+	}
+	return c.JSON(http.StatusOK, verification)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	cache "dreamfriday/cache"
+	models "dreamfriday/models"
+	PageEngine "dreamfriday/pageengine"
+	pageengine "dreamfriday/pageengine"
+	utils "dreamfriday/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RenderedPage is a production page rendered to HTML. The HTML has a placeholder in place of
+// the nonce, which is replaced with a fresh one every time the page is served.
+type RenderedPage struct {
+	HTML         []byte    `json:"html"`
+	Nonce        string    `json:"nonce"` // placeholder to replace
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"` // when the site's CID was published
+}
+
+// internal routes that answer the same for every visitor of a site. Pages importing any other
+// internal route aren't cached, so new routes are safe until they are added here.
+var sharedRoutes = []string{"/cid", "/domain", "/component/"}
+
+// isCacheablePage reports whether a page renders the same for every visitor. External imports
+// are never cached: components are fetched with the viewer's headers and cookies.
+func isCacheablePage(pageData pageengine.Page, components map[string]*pageengine.PageElement) bool {
+	if pageData.Gated(components) || pageData.Conditional(components) {
+		return false
+	}
+	for _, source := range pageData.Imports(components) {
+		if !sharedSource(source, components) {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedSource reports whether an import or repeat source is the same for every visitor
+func sharedSource(source string, components map[string]*pageengine.PageElement) bool {
+	if _, ok := components[source]; ok {
+		return true
+	}
+	if strings.HasPrefix(source, "data:") || strings.HasPrefix(source, "collection:") {
+		return true
+	}
+	if !strings.HasPrefix(source, "/") {
+		return false // external url
+	}
+	for _, route := range sharedRoutes {
+		if source == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(source, route)) {
+			return true
+		}
+	}
+	return false
+}
+
+func renderCacheKey(siteName, cid, pageName string) string {
+	return siteName + "|" + cid + "|" + pageName
+}
+
+// renderCachedPage serves a production page from RenderCache, rendering and caching it on a miss.
+// Keys include the site's CID, so publishing a new version never serves stale HTML.
+func renderCachedPage(c echo.Context, siteData *pageengine.SiteData, r pageRender) error {
+	siteName := utils.GetSubdomain(c.Request().Host)
+	pageName, pageData, record := r.Name, r.Page, r.Record
+	key := renderCacheKey(siteName, siteData.IPFSHash, pageName)
+	if record != nil || r.Params != nil {
+		// template and pattern pages render differently per path, so each path is cached separately
+		key += "|" + c.Request().URL.Path
+	}
+
+	var rendered *RenderedPage
+	if cached, found := cache.RenderCache.Get(key); found {
+		rendered, _ = cached.(*RenderedPage)
+	}
+
+	if rendered == nil {
+		var buf bytes.Buffer
+		placeholder := PageEngine.NewNonce()
+		pageengine := PageEngine.NewPageEngineWriter(c, siteData.Components, &buf)
+		pageengine.SetNonce(placeholder)
+		// cached pages only have page and param conditions, which are the same for every visitor of the path
+		pageengine.SetRenderContext(&PageEngine.RenderContext{Page: pageName, Params: r.Params})
+		pageengine.SetMarkdownCache(cache.MarkdownCache)
+		pageengine.SetDataSource(dataSource(c, siteData))
+		if record != nil {
+			pageengine.SetRecord(record)
+		}
+		if err := pageengine.RenderPage(pageData, RouteInternal, nil); err != nil {
+			log.Println("Unable to render page:", err)
+			return renderFailed(c, siteData, r)
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		publishedAt := models.PublishedAt(siteName, siteData.IPFSHash)
+		if publishedAt.IsZero() {
+			publishedAt = time.Now()
+		}
+		rendered = &RenderedPage{
+			HTML:         buf.Bytes(),
+			Nonce:        placeholder,
+			ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+			LastModified: publishedAt.UTC().Truncate(time.Second),
+		}
+		cache.RenderCache.Set(key, rendered)
+		log.Printf("Cached rendered page %s for site %s (%s)", pageName, siteName, siteData.IPFSHash)
+	}
+
+	header := c.Response().Header()
+	header.Set("ETag", rendered.ETag)
+	header.Set("Last-Modified", rendered.LastModified.Format(http.TimeFormat))
+	header.Set("Cache-Control", "no-cache") // always revalidate so login redirects still apply
+
+	if notModified(c.Request(), rendered) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.HTMLBlob(http.StatusOK, bytes.ReplaceAll(rendered.HTML, []byte(rendered.Nonce), []byte(PageEngine.NewNonce())))
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since when it is absent
+func notModified(r *http.Request, rendered *RenderedPage) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || tag == rendered.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !rendered.LastModified.After(t)
+		}
+	}
+	return false
+}
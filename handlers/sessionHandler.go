@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"dreamfriday/auth"
+	cache "dreamfriday/cache"
+	ethereum "dreamfriday/ethereum"
+	models "dreamfriday/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sessionInfo is a session as shown on the device list
+type sessionInfo struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"`
+}
+
+// ListSessions returns the current user's active sessions
+func ListSessions(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	sessions, err := models.ListSessions(handle)
+	if err != nil {
+		log.Println("Failed to list sessions:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list sessions"})
+	}
+
+	current := auth.CurrentSessionID(c)
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionInfo{
+			ID:        session.ID,
+			Provider:  session.Provider,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			IP:        session.IP,
+			UserAgent: session.UserAgent,
+			Current:   session.ID == current,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"sessions": result})
+}
+
+// RevokeSession ends one of the current user's sessions
+func RevokeSession(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	if err := auth.RevokeSession(handle, c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// RevokeAllSessions logs the current user out everywhere, including this session
+func RevokeAllSessions(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	if err := auth.RevokeAllSessions(handle); err != nil {
+		log.Println("Failed to revoke sessions:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+	clearPreviewCache(handle)
+	cache.UserDataStore.Delete(handle)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// AdminRevokeSessions kills every session of an address (or ENS name, or any other handle)
+func AdminRevokeSessions(c echo.Context) error {
+	address := c.Param("address")
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+	defer cancel()
+	if handle, err := ethereum.ResolveHandle(ctx, address); err == nil {
+		address = handle
+	}
+	if err := auth.RevokeAllSessions(address); err != nil {
+		log.Println("Failed to revoke sessions:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+	clearPreviewCache(address)
+	cache.UserDataStore.Delete(address)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked", "address": address})
+}
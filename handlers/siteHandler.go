@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"dreamfriday/auth"
+	cache "dreamfriday/cache"
+	ethereum "dreamfriday/ethereum"
+	models "dreamfriday/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SiteDeleteGrace is how long a deleted site can be restored before it is purged (SITE_DELETE_GRACE)
+var SiteDeleteGrace = 7 * 24 * time.Hour
+
+// TransferSite gives a site to another address (or ENS name)
+func TransferSite(c echo.Context) error {
+	site, handle, err := auth.AuthorizeSiteNamed(c, c.Param("name"), models.ActionManageSite)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	var request struct {
+		Address string `json:"address" form:"address"`
+	}
+	if err := c.Bind(&request); err != nil || strings.TrimSpace(request.Address) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "address is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 5*time.Second)
+	defer cancel()
+	newOwner, err := ethereum.ResolveHandle(ctx, request.Address)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := models.TransferSite(site.Name, handle, newOwner); err != nil {
+		log.Printf("Failed to transfer %s to %s: %v", site.Name, newOwner, err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	clearSitePreviewCache(site)
+	cache.UserDataStore.Delete(handle)
+	cache.UserDataStore.Delete(newOwner)
+	return c.JSON(http.StatusOK, map[string]string{"status": "transferred", "owner": newOwner})
+}
+
+// DeleteSite takes a site offline; it is purged after SiteDeleteGrace unless restored
+func DeleteSite(c echo.Context) error {
+	site, _, err := auth.AuthorizeSiteNamed(c, c.Param("name"), models.ActionManageSite)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	site, err = models.SoftDeleteSite(site.Name)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	purgeSiteCaches(site)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":   "deleted",
+		"purge_at": site.DeletedAt.Add(SiteDeleteGrace),
+	})
+}
+
+// RestoreSite brings back a deleted site during its grace period
+func RestoreSite(c echo.Context) error {
+	site, _, err := auth.AuthorizeSiteNamed(c, c.Param("name"), models.ActionManageSite)
+	if err != nil {
+		return auth.AccessDenied(c, err)
+	}
+	if _, err := models.RestoreSite(site.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "restored"})
+}
+
+// purgeSiteCaches drops everything cached for a site, so it stops being served
+func purgeSiteCaches(site *models.Site) {
+	cache.SiteDataStore.Delete(site.Name)
+	clearSitePreviewCache(site)
+	cache.UserDataStore.Delete(site.Owner)
+	for _, member := range site.Members {
+		cache.UserDataStore.Delete(member.Handle)
+	}
+}
+
+// SweepDeletedSites purges deleted sites whose grace period has passed, every interval
+func SweepDeletedSites(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sites, err := models.ExpiredDeletedSites(SiteDeleteGrace)
+		if err != nil {
+			log.Println("Failed to list deleted sites:", err)
+		}
+		for _, site := range sites {
+			purged, err := models.PurgeSite(site.Name)
+			if err != nil {
+				log.Printf("Failed to purge site %s: %v", site.Name, err)
+				continue
+			}
+			purgeSiteCaches(purged)
+		}
+		<-ticker.C
+	}
+}
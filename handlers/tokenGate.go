@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	auth "dreamfriday/auth"
+	ethereum "dreamfriday/ethereum"
+	pageengine "dreamfriday/pageengine"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/labstack/echo/v4"
+)
+
+// viewerPassesGate checks whether one of the logged in viewer's wallets holds enough of a gate's token
+func viewerPassesGate(c echo.Context, gate *pageengine.Gate) bool {
+	if gate == nil {
+		return true
+	}
+	if ethereum.Balances == nil {
+		log.Println("Token gates need ETH_RPC_URL, hiding gated content")
+		return false
+	}
+	min := gate.Min()
+	if (gate.Standard != "erc20" && gate.Standard != "erc721") || !common.IsHexAddress(gate.Contract) || min == nil {
+		log.Printf("Invalid token gate: %+v", gate)
+		return false
+	}
+	if !auth.IsAuthenticated(c) {
+		return false
+	}
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+	for _, wallet := range auth.Wallets(handle) {
+		balance, err := ethereum.Balances.BalanceOf(ctx, common.HexToAddress(gate.Contract), common.HexToAddress(wallet))
+		if err != nil {
+			log.Printf("Failed to check %s balance of %s: %v", gate.Contract, wallet, err)
+			continue
+		}
+		if balance.Cmp(min) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// gateChecker decides element gates for a render. Previews show everything, so editors can work on gated content.
+func gateChecker(c echo.Context, previewEnabled bool) func(*pageengine.Gate) bool {
+	return func(gate *pageengine.Gate) bool {
+		return previewEnabled || viewerPassesGate(c, gate)
+	}
+}
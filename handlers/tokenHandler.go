@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"dreamfriday/auth"
+	models "dreamfriday/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tokenRequest describes a token to issue, e.g. {"name":"deploy","sites":["blog"],"scopes":["write-preview","publish"],"expires_in":"720h"}
+type tokenRequest struct {
+	Name      string   `json:"name"`
+	Sites     []string `json:"sites"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"` // Go duration, empty never expires
+}
+
+// scopeActions maps token scopes to the site action they need
+var scopeActions = map[string]string{
+	auth.ScopeReadPreview:  models.ActionViewPreview,
+	auth.ScopeWritePreview: models.ActionEditPreview,
+	auth.ScopePublish:      models.ActionPublish,
+}
+
+// ListTokens returns the current user's API tokens, without their secrets
+func ListTokens(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	tokens, err := models.ListAPITokens(handle)
+	if err != nil {
+		log.Println("Failed to list tokens:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list tokens"})
+	}
+	for i := range tokens {
+		tokens[i].Hash = ""
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"tokens": tokens})
+}
+
+// CreateToken issues an API token for sites the current user collaborates on. The token is only returned once.
+func CreateToken(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	var request tokenRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+
+	var ttl time.Duration
+	if request.ExpiresIn != "" {
+		if ttl, err = time.ParseDuration(request.ExpiresIn); err != nil || ttl <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid expires_in"})
+		}
+	}
+
+	// a token can't do more than its owner's role on each site allows
+	for i, siteName := range request.Sites {
+		siteName = strings.TrimSpace(siteName)
+		request.Sites[i] = siteName
+		site, err := models.GetSite(siteName)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Site not found: " + siteName})
+		}
+		for _, scope := range request.Scopes {
+			if !site.Can(handle, scopeActions[scope]) {
+				log.Printf("Forbidden: %s requested a %s token for %s", handle, scope, siteName)
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Your role on " + siteName + " does not allow " + scope})
+			}
+		}
+	}
+
+	token, record, err := auth.IssueToken(handle, request.Name, request.Sites, request.Scopes, ttl)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	record.Hash = ""
+	return c.JSON(http.StatusCreated, map[string]interface{}{"token": token, "details": record})
+}
+
+// RevokeToken deletes one of the current user's API tokens
+func RevokeToken(c echo.Context) error {
+	handle, err := auth.GetHandle(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	if err := models.DeleteAPIToken(handle, c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	log.Printf("Revoked API token %s for %s", c.Param("id"), handle)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	handlers "dreamfriday/handlers"
+	models "dreamfriday/models"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -28,7 +30,7 @@ func LoadSiteDataMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			if err != nil {
 				log.Println("Failed to fetch preview data:", err)
 				previewHandler.SetPreview(c, false)
-				return c.String(http.StatusInternalServerError, "Failed to fetch preview data")
+				return handlers.ErrorFallback(c, http.StatusInternalServerError, "Failed to fetch preview data")
 			}
 			c.Set("siteData", previewData.SiteData)
 			return next(c)
@@ -37,9 +39,12 @@ func LoadSiteDataMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 		// handle site data
 		siteData, err := handlers.GetSiteData(c)
+		if errors.Is(err, models.ErrSiteDeleted) || errors.Is(err, models.ErrSiteNotFound) {
+			return handlers.ErrorFallback(c, http.StatusNotFound, "Site not found")
+		}
 		if err != nil {
 			log.Println("Failed to fetch site data:", err)
-			return c.String(http.StatusInternalServerError, "Failed to fetch site data")
+			return handlers.ErrorFallback(c, http.StatusInternalServerError, "Failed to fetch site data")
 		}
 
 		c.Set("siteData", siteData)
@@ -0,0 +1,75 @@
+package models
+
+import (
+	database "dreamfriday/database"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// identityKey is how an external identity is stored, e.g. "email:alice@example.com"
+func identityKey(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// FindIdentity returns the handle of the user an external identity is linked to
+func FindIdentity(provider, subject string) (string, error) {
+	var handle string
+	if err := database.Get("Identities", identityKey(provider, subject), &handle); err != nil {
+		return "", fmt.Errorf("identity not linked: %w", err)
+	}
+	return handle, nil
+}
+
+// LinkIdentity maps an external identity to a user, creating the user if needed.
+// An identity can only belong to one user.
+func LinkIdentity(handle, provider, subject string) error {
+	key := identityKey(provider, subject)
+	if existing, err := FindIdentity(provider, subject); err == nil && existing != handle {
+		return fmt.Errorf("%s is already linked to another account", key)
+	}
+
+	user, err := GetUser(handle)
+	if err != nil {
+		user = &User{Address: handle, Sites: []string{}}
+	}
+	linked := false
+	for _, identity := range user.Identities {
+		if identity == key {
+			linked = true
+			break
+		}
+	}
+	if !linked {
+		user.Identities = append(user.Identities, key)
+		if err := user.Save(); err != nil {
+			return err
+		}
+	}
+
+	if err := database.Put("Identities", key, handle); err != nil {
+		return err
+	}
+	log.Printf("Linked identity %s to %s", key, handle)
+	return nil
+}
+
+// Wallets returns the lowercase addresses a user can sign with: their handle if it is an address,
+// and any linked eth identities
+func Wallets(handle string) []string {
+	var wallets []string
+	if common.IsHexAddress(handle) {
+		wallets = append(wallets, strings.ToLower(handle))
+	}
+	if user, err := GetUser(handle); err == nil {
+		for _, identity := range user.Identities {
+			if address, ok := strings.CutPrefix(identity, "eth:"); ok && !slices.Contains(wallets, address) {
+				wallets = append(wallets, address)
+			}
+		}
+	}
+	return wallets
+}
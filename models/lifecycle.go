@@ -0,0 +1,210 @@
+package models
+
+import (
+	ipfs "dreamfriday/IPFS"
+	database "dreamfriday/database"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SiteStatusDeleted marks a soft deleted site, restorable until it is purged
+const SiteStatusDeleted = "deleted"
+
+// ErrSiteDeleted is returned when loading a site that was deleted
+var ErrSiteDeleted = errors.New("site was deleted")
+
+// ErrSiteNotFound is returned when loading a site that doesn't exist
+var ErrSiteNotFound = errors.New("site not found")
+
+// TransferSite makes to the owner of a site owned by from. The site and both users'
+// site lists are updated in one transaction, so a failure leaves everything as it was.
+func TransferSite(name, from, to string) error {
+	if from == to {
+		return fmt.Errorf("%s already owns %s", to, name)
+	}
+	err := database.Update(func(tx *database.Tx) error {
+		var site Site
+		if err := tx.Get("Sites", name, &site); err != nil {
+			return fmt.Errorf("site %s not found", name)
+		}
+		if site.Owner != from {
+			return fmt.Errorf("%s does not own %s", from, name)
+		}
+		if site.Status == SiteStatusDeleted {
+			return fmt.Errorf("%s was deleted", name)
+		}
+
+		// the new owner no longer needs a membership
+		members := site.Members[:0]
+		for _, member := range site.Members {
+			if member.Handle != to {
+				members = append(members, member)
+			}
+		}
+		site.Members = members
+		site.Owner = to
+
+		var previous User
+		if err := tx.Get("Users", from, &previous); err == nil {
+			previous.Sites = without(previous.Sites, name)
+			if err := tx.Put("Users", from, previous); err != nil {
+				return err
+			}
+		}
+
+		var next User
+		if err := tx.Get("Users", to, &next); err != nil {
+			next = User{Address: to, Sites: []string{}}
+		}
+		next.Sites = append(without(next.Sites, name), name)
+		if err := tx.Put("Users", to, next); err != nil {
+			return err
+		}
+		return tx.Put("Sites", name, site)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Transferred %s from %s to %s", name, from, to)
+	return nil
+}
+
+func without(values []string, value string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// SoftDeleteSite takes a site offline. It can be restored until PurgeSite runs.
+func SoftDeleteSite(name string) (*Site, error) {
+	site, err := ModifySite(name, func(site *Site) error {
+		if site.Status == SiteStatusDeleted {
+			return fmt.Errorf("%s was already deleted", name)
+		}
+		site.Status = SiteStatusDeleted
+		site.DeletedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Deleted site:", name)
+	return site, nil
+}
+
+// RestoreSite brings a soft deleted site back online
+func RestoreSite(name string) (*Site, error) {
+	site, err := ModifySite(name, func(site *Site) error {
+		if site.Status != SiteStatusDeleted {
+			return fmt.Errorf("%s is not deleted", name)
+		}
+		site.Status = "published"
+		site.DeletedAt = time.Time{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Restored site:", name)
+	return site, nil
+}
+
+// PurgeSite permanently removes a soft deleted site: its CID is unpinned, it is removed
+// from every collaborator's site list, and its name becomes available again
+func PurgeSite(name string) (*Site, error) {
+	var site Site
+	var versions []SiteVersion
+	err := database.Update(func(tx *database.Tx) error {
+		if err := tx.Get("Sites", name, &site); err != nil {
+			return fmt.Errorf("site %s not found", name)
+		}
+		if site.Status != SiteStatusDeleted {
+			return fmt.Errorf("%s is not deleted", name)
+		}
+
+		handles := []string{site.Owner}
+		for _, member := range site.Members {
+			handles = append(handles, member.Handle)
+		}
+		for _, handle := range handles {
+			var user User
+			if err := tx.Get("Users", handle, &user); err != nil {
+				continue
+			}
+			user.Sites = without(user.Sites, name)
+			if err := tx.Put("Users", handle, user); err != nil {
+				return err
+			}
+		}
+		tx.Get("SiteVersions", name, &versions)
+		if err := tx.Delete("SiteVersions", name); err != nil {
+			return err
+		}
+		return tx.Delete("Sites", name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// unpin the current CID and every CID in the site's history. Sites created from the same template
+	// share a CID, so only content no other site publishes or has published is unpinned.
+	// A failed unpin is logged and left for IPFS garbage collection tooling.
+	cids := []string{site.IPFSHash}
+	for _, version := range versions {
+		cids = append(cids, version.CID)
+	}
+	inUse := cidsInUse()
+	unpinned := make(map[string]bool)
+	for _, cid := range cids {
+		if cid == "" || unpinned[cid] || inUse == nil || inUse[cid] {
+			continue
+		}
+		unpinned[cid] = true
+		if err := ipfs.UnpinFile(cid); err != nil {
+			log.Printf("Failed to unpin %s for purged site %s: %v", cid, name, err)
+		}
+		pruneSiteDataSnapshot(cid)
+	}
+	log.Println("Purged site:", name)
+	return &site, nil
+}
+
+// cidsInUse returns every CID a site publishes or has in its version history,
+// or nil if they can't be listed, in which case everything must be assumed in use
+func cidsInUse() map[string]bool {
+	sites, err := ListSites()
+	if err != nil {
+		log.Println("Failed to list sites for CIDs in use:", err)
+		return nil
+	}
+	inUse := make(map[string]bool)
+	for _, site := range sites {
+		inUse[site.IPFSHash] = true
+		versions, _ := ListSiteVersions(site.Name)
+		for _, version := range versions {
+			inUse[version.CID] = true
+		}
+	}
+	return inUse
+}
+
+// ExpiredDeletedSites lists deleted sites whose grace period has passed
+func ExpiredDeletedSites(grace time.Duration) ([]Site, error) {
+	sites, err := ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var expired []Site
+	for _, site := range sites {
+		if site.Status == SiteStatusDeleted && time.Since(site.DeletedAt) > grace {
+			expired = append(expired, site)
+		}
+	}
+	return expired, nil
+}
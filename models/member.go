@@ -0,0 +1,181 @@
+package models
+
+import (
+	database "dreamfriday/database"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Site roles, from most to least access
+const (
+	RoleOwner     = "owner"     // everything, including managing members
+	RolePublisher = "publisher" // edit preview and publish
+	RoleEditor    = "editor"    // edit preview only
+	RoleViewer    = "viewer"    // see preview
+)
+
+// Actions a role may be allowed on a site
+const (
+	ActionViewPreview   = "view-preview"
+	ActionEditPreview   = "edit-preview"
+	ActionPublish       = "publish"
+	ActionManageMembers = "manage-members"
+	ActionManageSite    = "manage-site" // transfer, delete and restore
+)
+
+var rolePermissions = map[string]map[string]bool{
+	RoleOwner:     {ActionViewPreview: true, ActionEditPreview: true, ActionPublish: true, ActionManageMembers: true, ActionManageSite: true},
+	RolePublisher: {ActionViewPreview: true, ActionEditPreview: true, ActionPublish: true},
+	RoleEditor:    {ActionViewPreview: true, ActionEditPreview: true},
+	RoleViewer:    {ActionViewPreview: true},
+}
+
+// ValidRole reports whether role can be given to a member (owner can't, there is only one)
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok && role != RoleOwner
+}
+
+// RoleOf returns handle's role on the site, or "" if it has none
+func (s *Site) RoleOf(handle string) string {
+	if handle == "" {
+		return ""
+	}
+	if s.Owner == handle {
+		return RoleOwner
+	}
+	for _, member := range s.Members {
+		if member.Handle == handle && member.Accepted {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// Can reports whether handle may perform action on the site
+func (s *Site) Can(handle, action string) bool {
+	return rolePermissions[s.RoleOf(handle)][action]
+}
+
+// member returns the membership (accepted or not) of handle
+func (s *Site) member(handle string) *Member {
+	for i := range s.Members {
+		if s.Members[i].Handle == handle {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// InviteMember invites handle to the site with role, or changes the role of an existing member
+func InviteMember(siteName, handle, role, invitedBy string) (*Member, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	var member Member
+	err := database.Update(func(tx *database.Tx) error {
+		var site Site
+		if err := tx.Get("Sites", siteName, &site); err != nil {
+			return err
+		}
+		if site.Owner == handle {
+			return fmt.Errorf("%s already owns %s", handle, siteName)
+		}
+
+		if existing := site.member(handle); existing != nil {
+			existing.Role = role
+			member = *existing
+		} else {
+			member = Member{
+				Handle:    handle,
+				Role:      role,
+				InvitedBy: invitedBy,
+				InvitedAt: time.Now(),
+			}
+			site.Members = append(site.Members, member)
+		}
+		return tx.Put("Sites", siteName, site)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Invited %s to %s as %s", handle, siteName, role)
+	return &member, nil
+}
+
+// AcceptInvitation activates handle's pending membership and lists the site under the user.
+// Both are updated in one transaction.
+func AcceptInvitation(siteName, handle string) (*Member, error) {
+	var member Member
+	err := database.Update(func(tx *database.Tx) error {
+		var site Site
+		if err := tx.Get("Sites", siteName, &site); err != nil {
+			return err
+		}
+		existing := site.member(handle)
+		if existing == nil {
+			return fmt.Errorf("no invitation to %s for %s", siteName, handle)
+		}
+		if existing.Accepted {
+			member = *existing
+			return nil
+		}
+		existing.Accepted = true
+		existing.AcceptedAt = time.Now()
+		member = *existing
+
+		var user User
+		if err := tx.Get("Users", handle, &user); err != nil {
+			user = User{Address: handle, Sites: []string{}}
+		}
+		user.Sites = append(without(user.Sites, siteName), siteName)
+		if err := tx.Put("Users", handle, user); err != nil {
+			return err
+		}
+		return tx.Put("Sites", siteName, site)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%s accepted invitation to %s", handle, siteName)
+	return &member, nil
+}
+
+// RemoveMember removes a member or pending invitation from the site, and the site from
+// the member's site list, in one transaction
+func RemoveMember(siteName, handle string) error {
+	err := database.Update(func(tx *database.Tx) error {
+		var site Site
+		if err := tx.Get("Sites", siteName, &site); err != nil {
+			return err
+		}
+		if site.Owner == handle {
+			return fmt.Errorf("the owner can't be removed")
+		}
+		if site.member(handle) == nil {
+			return fmt.Errorf("%s is not a member of %s", handle, siteName)
+		}
+		members := site.Members[:0]
+		for _, member := range site.Members {
+			if member.Handle != handle {
+				members = append(members, member)
+			}
+		}
+		site.Members = members
+
+		var user User
+		if err := tx.Get("Users", handle, &user); err == nil {
+			user.Sites = without(user.Sites, siteName)
+			if err := tx.Put("Users", handle, user); err != nil {
+				return err
+			}
+		}
+		return tx.Put("Sites", siteName, site)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Removed %s from %s", handle, siteName)
+	return nil
+}
@@ -1,19 +1,76 @@
 package models
 
+import "time"
+
 type AuthResponse struct {
 	AccessToken string // Auth0: access_token | AT: accessJwt
 	DID         string // Only relevant for AT Protocol users
 }
 
 type Site struct {
-	Name        string `json:"name"`
-	IPFSHash    string `json:"ipfs_hash"` // production
-	PreviewData string `json:"preview_data"`
-	Owner       string `json:"owner"`
-	Status      string `json:"status"`
+	Name        string    `json:"name"`
+	IPFSHash    string    `json:"ipfs_hash"` // production
+	PreviewData string    `json:"preview_data"`
+	Owner       string    `json:"owner"`
+	Status      string    `json:"status"`
+	Members     []Member  `json:"members,omitempty"`    // collaborators besides the owner
+	DeletedAt   time.Time `json:"deleted_at,omitempty"` // set while a deleted site waits to be purged
+}
+
+// Member is a collaborator on a site. Invitations only grant access once accepted.
+type Member struct {
+	Handle     string    `json:"handle"`
+	Role       string    `json:"role"`
+	InvitedBy  string    `json:"invited_by"`
+	InvitedAt  time.Time `json:"invited_at"`
+	Accepted   bool      `json:"accepted"`
+	AcceptedAt time.Time `json:"accepted_at,omitempty"`
 }
 
 type User struct {
-	Address string   `json:"address"`
-	Sites   []string `json:"sites"`
+	Address    string    `json:"address"` // handle
+	Sites      []string  `json:"sites"`
+	Identities []string  `json:"identities,omitempty"` // linked logins, e.g. "eth:0x..." or "email:alice@example.com"
+	Passkeys   []Passkey `json:"passkeys,omitempty"`
+}
+
+// Passkey is a WebAuthn credential registered to a user
+type Passkey struct {
+	ID        string    `json:"id"`         // base64url credential ID
+	PublicKey []byte    `json:"public_key"` // COSE encoded
+	SignCount uint32    `json:"sign_count"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
+}
+
+// SiteDataSnapshot is the last known good copy of published site data, keyed by CID
+type SiteDataSnapshot struct {
+	CID     string    `json:"cid"`
+	Data    string    `json:"data"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// Session is a server-side login session, referenced by ID from the session cookie
+type Session struct {
+	ID        string    `json:"id"`
+	Handle    string    `json:"handle"`
+	Provider  string    `json:"provider"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// APIToken is a bearer token for programmatic site management. Only a hash of the
+// token is stored; the token itself is shown once, when it is issued.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"` // sha256 of the token, the Bolt key
+	Handle    string    `json:"handle"`
+	Name      string    `json:"name"`
+	Sites     []string  `json:"sites"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero means it never expires
+	LastUsed  time.Time `json:"last_used,omitempty"`
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// AddPasskey registers a WebAuthn credential to a user and links it as a "webauthn" identity
+func AddPasskey(handle string, passkey Passkey) error {
+	if err := LinkIdentity(handle, "webauthn", passkey.ID); err != nil {
+		return err
+	}
+	user, err := GetUser(handle)
+	if err != nil {
+		return err
+	}
+	for _, existing := range user.Passkeys {
+		if existing.ID == passkey.ID {
+			return nil
+		}
+	}
+	user.Passkeys = append(user.Passkeys, passkey)
+	return user.Save()
+}
+
+// FindPasskey returns the user a credential belongs to, and the credential
+func FindPasskey(id string) (*User, *Passkey, error) {
+	handle, err := FindIdentity("webauthn", id)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := GetUser(handle)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range user.Passkeys {
+		if user.Passkeys[i].ID == id {
+			return user, &user.Passkeys[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("passkey %s not found for %s", id, handle)
+}
+
+// TouchPasskey records a successful assertion and the authenticator's new signature counter
+func TouchPasskey(id string, signCount uint32) error {
+	user, passkey, err := FindPasskey(id)
+	if err != nil {
+		return err
+	}
+	passkey.SignCount = signCount
+	passkey.LastUsed = time.Now()
+	return user.Save()
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	database "dreamfriday/database"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// SaveSession stores or updates a login session
+func SaveSession(session *Session) error {
+	return database.Put("Sessions", session.ID, session)
+}
+
+// GetSession returns a login session by ID
+func GetSession(id string) (*Session, error) {
+	var session Session
+	if err := database.Get("Sessions", id, &session); err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	return &session, nil
+}
+
+// DeleteSession revokes a login session
+func DeleteSession(id string) error {
+	return database.Delete("Sessions", id)
+}
+
+// ListSessions returns a user's sessions, most recently seen first
+func ListSessions(handle string) ([]Session, error) {
+	var sessions []Session
+	err := database.ForEach("Sessions", func(_ string, value []byte) error {
+		var session Session
+		if err := json.Unmarshal(value, &session); err != nil {
+			return nil
+		}
+		if session.Handle == handle {
+			sessions = append(sessions, session)
+		}
+		return nil
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, err
+}
+
+// DeleteSessions revokes every session of a user, except the session ID in keep (if any)
+func DeleteSessions(handle, keep string) error {
+	return database.DeleteWhere("Sessions", func(id string, value []byte) bool {
+		var session Session
+		if err := json.Unmarshal(value, &session); err != nil {
+			return false
+		}
+		return session.Handle == handle && id != keep
+	})
+}
+
+// PruneSessions removes sessions that haven't been seen within maxIdle
+func PruneSessions(maxIdle time.Duration) {
+	cutoff := time.Now().Add(-maxIdle)
+	err := database.DeleteWhere("Sessions", func(_ string, value []byte) bool {
+		var session Session
+		if err := json.Unmarshal(value, &session); err != nil {
+			return true
+		}
+		return session.LastSeen.Before(cutoff)
+	})
+	if err != nil {
+		log.Println("Failed to prune sessions:", err)
+	}
+}
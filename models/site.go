@@ -1,12 +1,19 @@
 package models
 
 import (
+	"context"
 	ipfs "dreamfriday/IPFS"
 	database "dreamfriday/database"
+	ethereum "dreamfriday/ethereum"
 	"dreamfriday/pageengine"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 func GetSite(name string) (*Site, error) {
@@ -23,13 +30,36 @@ func UpdateSite(name string, site *Site) error {
 	return database.Put("Sites", name, site)
 }
 
+// ModifySite re-reads a site and applies modify to it in one transaction, so nothing written
+// since the caller last loaded the site is lost. If modify returns an error nothing is written.
+func ModifySite(name string, modify func(site *Site) error) (*Site, error) {
+	var site Site
+	err := database.Update(func(tx *database.Tx) error {
+		if err := tx.Get("Sites", name, &site); err != nil {
+			return err
+		}
+		if err := modify(&site); err != nil {
+			return err
+		}
+		return tx.Put("Sites", name, site)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
 func CreateSite(name, owner, siteData string) (*Site, error) {
+	if _, err := GetSite(name); err == nil {
+		return nil, fmt.Errorf("site name %s is taken", name)
+	}
 	hash, err := ipfs.PutFile(siteData)
 	if err != nil {
 		log.Printf("Failed to add site data for %s on ipfs: %v", name, err)
 		return nil, err
 	}
 	log.Printf("Saved site %s on ipfs: %s", name, hash)
+	SaveSiteDataSnapshot(hash, siteData)
 	site := Site{
 		IPFSHash:    hash,
 		PreviewData: siteData,
@@ -55,27 +85,65 @@ func CreateSite(name, owner, siteData string) (*Site, error) {
 // 	return UpdateSite(name, site)
 // }
 
-func PublishSite(site *Site) error {
+// ErrPublishConflict is returned when a site was published again since the manifest was signed
+var ErrPublishConflict = errors.New("site was published since the manifest was signed")
 
+// PublishSite publishes a site's preview data to IPFS. The data must hash to the CID in the signed
+// manifest, which is appended to the site's version history along with the new CID. The site must
+// still be at the manifest's previous CID when the version is recorded, so concurrent publishes can't
+// both succeed.
+func PublishSite(site *Site, manifest *PublishManifest, handle string) error {
 	previewData := site.PreviewData
-	hash := site.IPFSHash
 	siteName := site.Name
 
 	log.Println("Publishing site:", siteName)
-	log.Println("TODO: Unpin hash:", hash)
+	log.Println("TODO: Unpin hash:", manifest.PreviousCID)
 
 	hash, err := ipfs.PutFile(previewData)
 	if err != nil {
 		log.Printf("Failed to save site to ipfs %s: %v", siteName, err)
 		return err
 	}
+	if hash != manifest.CID {
+		return fmt.Errorf("published CID %s does not match the signed manifest's %s", hash, manifest.CID)
+	}
 	log.Printf("Saved site %s on ipfs: %s", siteName, hash)
-	site.IPFSHash = hash
-	site.Status = "published"
+	SaveSiteDataSnapshot(hash, previewData)
+
+	var published Site
+	err = database.Update(func(tx *database.Tx) error {
+		if err := tx.Get("Sites", siteName, &published); err != nil {
+			return fmt.Errorf("site %s not found", siteName)
+		}
+		if published.IPFSHash != manifest.PreviousCID {
+			return ErrPublishConflict
+		}
+		published.IPFSHash = hash
+		published.Status = "published"
 
-	err = UpdateSite(siteName, site)
+		var versions []SiteVersion
+		tx.Get("SiteVersions", siteName, &versions)
+		versions = append(versions, SiteVersion{
+			PublishManifest: *manifest,
+			PublishedBy:     handle,
+			PublishedAt:     time.Now(),
+		})
+		if err := tx.Put("SiteVersions", siteName, versions); err != nil {
+			return err
+		}
+		return tx.Put("Sites", siteName, published)
+	})
 	if err != nil {
 		log.Printf("Failed to update site %s: %v", siteName, err)
+		if hash != manifest.PreviousCID {
+			pruneSiteDataSnapshot(hash)
+		}
+		return err
+	}
+
+	*site = published
+	if manifest.PreviousCID != hash {
+		pruneSiteDataSnapshot(manifest.PreviousCID)
 	}
 
 	log.Println("TODO: Pin hash:", hash)
@@ -87,27 +155,176 @@ func GetSiteData(name string) (string, error) {
 	log.Println("Fetching site data for:", name)
 
 	site, err := GetSite(name)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", fmt.Errorf("%s: %w", name, ErrSiteNotFound)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve site info for %s: %w", name, err)
 	}
+	if site.Status == SiteStatusDeleted {
+		return "", fmt.Errorf("%s: %w", name, ErrSiteDeleted)
+	}
+
+	cid := ServedCID(site)
+	data, err := ipfs.GetFile(cid)
+	if err != nil {
+		// IPFS is unreachable, fall back to the last known good copy in bolt
+		snapshot, snapshotErr := GetSiteDataSnapshot(cid)
+		if snapshotErr != nil {
+			return "", fmt.Errorf("failed to retrieve IPFS file for %s (%s): %w", name, cid, err)
+		}
+		log.Printf("IPFS unavailable for %s (%s), serving snapshot saved at %s: %v", name, cid, snapshot.SavedAt, err)
+		return processSiteData(name, cid, snapshot.Data)
+	}
+
+	siteDataJSON, err := processSiteData(name, cid, data)
+	if err != nil {
+		return "", err
+	}
+	SaveSiteDataSnapshot(cid, data)
+
+	log.Printf("Successfully retrieved and processed site data for %s (%s)", name, cid)
+	return siteDataJSON, nil
+}
 
-	data, err := ipfs.GetFile(site.IPFSHash)
+// GetSiteDataFromSnapshot returns a site's published data from bolt only, without contacting IPFS
+func GetSiteDataFromSnapshot(name string) (string, error) {
+	site, err := GetSite(name)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", fmt.Errorf("%s: %w", name, ErrSiteNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve site info for %s: %w", name, err)
+	}
+	if site.Status == SiteStatusDeleted {
+		return "", fmt.Errorf("%s: %w", name, ErrSiteDeleted)
+	}
+	cid := ServedCID(site)
+	snapshot, err := GetSiteDataSnapshot(cid)
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve IPFS file for %s (%s): %w", name, site.IPFSHash, err)
+		return "", err
 	}
+	return processSiteData(name, cid, snapshot.Data)
+}
 
+// ServedCID returns the CID a site's production data is served from. With registry resolution enabled
+// the on-chain record wins over Bolt, but only when it was set by one of the site owner's wallets: anyone
+// can register an unclaimed name. Bolt is used otherwise, or when the chain is unreachable.
+func ServedCID(site *Site) string {
+	if ethereum.SiteCIDs == nil {
+		return site.IPFSHash
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	registration, err := ethereum.SiteCIDs.Lookup(ctx, site.Name)
+	if err != nil {
+		log.Printf("Failed to resolve %s from the site registry, serving %s from Bolt: %v", site.Name, site.IPFSHash, err)
+		return site.IPFSHash
+	}
+	if registration.CID == "" {
+		return site.IPFSHash
+	}
+	registrant := strings.ToLower(registration.Owner.Hex())
+	if !slices.Contains(Wallets(site.Owner), registrant) {
+		warnForeignRegistrant(site.Name, registrant, site.IPFSHash)
+		return site.IPFSHash
+	}
+	if registration.CID != site.IPFSHash {
+		warnCIDMismatch(site.Name, site.IPFSHash, registration.CID)
+	}
+	return registration.CID
+}
+
+// last mismatch logged per site, so a disagreement is reported once rather than on every request
+var cidMismatches sync.Map
+
+func warnCIDMismatch(name, boltCID, chainCID string) {
+	mismatch := boltCID + "|" + chainCID
+	if previous, found := cidMismatches.Swap(name, mismatch); found && previous == mismatch {
+		return
+	}
+	log.Printf("WARNING: Bolt has %s for site %s but the site registry has %s, serving the registry's CID", boltCID, name, chainCID)
+}
+
+// warnForeignRegistrant reports, once per registrant, a registry record for a site set by a wallet its owner doesn't hold
+func warnForeignRegistrant(name, registrant, boltCID string) {
+	if previous, found := cidMismatches.Swap(name, "registrant|"+registrant); found && previous == "registrant|"+registrant {
+		return
+	}
+	log.Printf("WARNING: Site %s is registered on chain by %s, which is not a wallet of its owner; serving %s from Bolt", name, registrant, boltCID)
+}
+
+// validates raw site data and stamps it with the CID it was loaded from
+func processSiteData(name, cid, data string) (string, error) {
 	var siteData pageengine.SiteData
 	if err := json.Unmarshal([]byte(data), &siteData); err != nil {
-		return "", fmt.Errorf("failed to unmarshal site data for %s (%s): %w", name, site.IPFSHash, err)
+		return "", fmt.Errorf("failed to unmarshal site data for %s (%s): %w", name, cid, err)
 	}
 
-	siteData.IPFSHash = site.IPFSHash
+	siteData.IPFSHash = cid
 
 	siteDataJSON, err := json.Marshal(siteData)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal site data for %s (%s): %w", name, site.IPFSHash, err)
+		return "", fmt.Errorf("failed to marshal site data for %s (%s): %w", name, cid, err)
 	}
-
-	log.Printf("Successfully retrieved and processed site data for %s (%s)", name, site.IPFSHash)
 	return string(siteDataJSON), nil
 }
+
+// ListSites returns every site in the Sites bucket
+func ListSites() ([]Site, error) {
+	var sites []Site
+	err := database.ForEach("Sites", func(name string, value []byte) error {
+		var site Site
+		if err := json.Unmarshal(value, &site); err != nil {
+			log.Printf("Skipping unreadable site %s: %v", name, err)
+			return nil
+		}
+		sites = append(sites, site)
+		return nil
+	})
+	return sites, err
+}
+
+// SaveSiteDataSnapshot stores the last known good site data for a CID in bolt
+func SaveSiteDataSnapshot(cid, data string) {
+	if cid == "" {
+		return
+	}
+	snapshot := SiteDataSnapshot{
+		CID:     cid,
+		Data:    data,
+		SavedAt: time.Now().UTC(),
+	}
+	if err := database.Put("SiteDataCache", cid, snapshot); err != nil {
+		log.Printf("Failed to save site data snapshot %s: %v", cid, err)
+	}
+}
+
+// GetSiteDataSnapshot returns the site data stored in bolt for a CID
+func GetSiteDataSnapshot(cid string) (*SiteDataSnapshot, error) {
+	var snapshot SiteDataSnapshot
+	if err := database.Get("SiteDataCache", cid, &snapshot); err != nil {
+		return nil, fmt.Errorf("no snapshot for %s: %w", cid, err)
+	}
+	return &snapshot, nil
+}
+
+// removes a snapshot once no site references its CID anymore
+func pruneSiteDataSnapshot(cid string) {
+	if cid == "" {
+		return
+	}
+	sites, err := ListSites()
+	if err != nil {
+		log.Printf("Failed to list sites while pruning snapshot %s: %v", cid, err)
+		return
+	}
+	for _, site := range sites {
+		if site.IPFSHash == cid {
+			return
+		}
+	}
+	if err := database.Delete("SiteDataCache", cid); err != nil {
+		log.Printf("Failed to prune snapshot %s: %v", cid, err)
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	database "dreamfriday/database"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SaveAPIToken stores or updates an API token, keyed by its hash
+func SaveAPIToken(token *APIToken) error {
+	return database.Put("APITokens", token.Hash, token)
+}
+
+// GetAPITokenByHash returns the token with the given sha256 hash
+func GetAPITokenByHash(hash string) (*APIToken, error) {
+	var token APIToken
+	if err := database.Get("APITokens", hash, &token); err != nil {
+		return nil, fmt.Errorf("token not found: %w", err)
+	}
+	return &token, nil
+}
+
+// ListAPITokens returns a user's tokens, newest first
+func ListAPITokens(handle string) ([]APIToken, error) {
+	var tokens []APIToken
+	err := database.ForEach("APITokens", func(_ string, value []byte) error {
+		var token APIToken
+		if err := json.Unmarshal(value, &token); err != nil {
+			return nil
+		}
+		if token.Handle == handle {
+			tokens = append(tokens, token)
+		}
+		return nil
+	})
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, err
+}
+
+// DeleteAPIToken revokes one of a user's tokens by ID
+func DeleteAPIToken(handle, id string) error {
+	found := false
+	err := database.DeleteWhere("APITokens", func(_ string, value []byte) bool {
+		var token APIToken
+		if err := json.Unmarshal(value, &token); err != nil {
+			return false
+		}
+		if token.Handle == handle && token.ID == id {
+			found = true
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
@@ -51,3 +51,19 @@ func AddSiteToUser(userAddress, siteName string) error {
 	// Save the updated user record
 	return user.Save()
 }
+
+// RemoveSiteFromUser removes a site name from the user's collection of sites.
+func RemoveSiteFromUser(userAddress, siteName string) error {
+	user, err := GetUser(userAddress)
+	if err != nil {
+		return err
+	}
+	sites := user.Sites[:0]
+	for _, s := range user.Sites {
+		if s != siteName {
+			sites = append(sites, s)
+		}
+	}
+	user.Sites = sites
+	return user.Save()
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	database "dreamfriday/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PublishManifest is what a wallet signs to authorize publishing a site's preview data as a specific CID
+type PublishManifest struct {
+	Site        string    `json:"site" form:"site"`
+	CID         string    `json:"cid" form:"cid"`
+	PreviousCID string    `json:"previous_cid" form:"previous_cid"`
+	Timestamp   time.Time `json:"timestamp" form:"timestamp"`
+	Signer      string    `json:"signer" form:"signer"`
+	Signature   string    `json:"signature" form:"signature"`
+}
+
+// Message is the text signed with personal_sign. Anyone can rebuild it from the manifest to check the signature.
+func (m *PublishManifest) Message() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Publish %s\n", m.Site)
+	fmt.Fprintf(&b, "CID: %s\n", m.CID)
+	fmt.Fprintf(&b, "Previous CID: %s\n", m.PreviousCID)
+	fmt.Fprintf(&b, "Timestamp: %s", m.Timestamp.UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+// SiteVersion is one entry in a site's publish history
+type SiteVersion struct {
+	PublishManifest
+	PublishedBy string    `json:"published_by"` // handle of the user who published
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// ListSiteVersions returns a site's signed publishes, oldest first
+func ListSiteVersions(name string) ([]SiteVersion, error) {
+	var versions []SiteVersion
+	if err := database.Get("SiteVersions", name, &versions); err != nil {
+		return []SiteVersion{}, nil
+	}
+	return versions, nil
+}
+
+// PublishedAt returns when cid was last published for a site, or the zero time if it never was,
+// e.g. for sites published before versions were recorded
+func PublishedAt(name, cid string) time.Time {
+	versions, _ := ListSiteVersions(name)
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].CID == cid {
+			return versions[i].PublishedAt
+		}
+	}
+	return time.Time{}
+}
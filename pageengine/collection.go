@@ -0,0 +1,231 @@
+package pageengine
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collection is a list of typed records, ex: blog posts, rendered one per url with a template page
+type Collection struct {
+	Path     string            `json:"path"`            // records are served at /<path>/<slug>
+	Template string            `json:"template"`        // page rendered for each record, {{field}} is bound to the record
+	Fields   map[string]string `json:"fields"`          // field name -> "string", "text", "number", "boolean" or "date"
+	Order    string            `json:"order,omitempty"` // field to list records by, prefixed with "-" for descending
+	Records  []Record          `json:"records"`
+}
+
+// Record is one entry of a collection. Every record has a unique slug.
+type Record map[string]interface{}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Slug returns the record's slug, or "" if it has none
+func (r Record) Slug() string {
+	slug, _ := r["slug"].(string)
+	return slug
+}
+
+// Validate checks a record against the collection's fields
+func (col *Collection) Validate(record Record) error {
+	if !slugPattern.MatchString(record.Slug()) {
+		return fmt.Errorf("slug must be lowercase letters, numbers and dashes")
+	}
+	if len(col.Fields) == 0 {
+		return nil
+	}
+	for name, value := range record {
+		if name == "slug" {
+			continue
+		}
+		fieldType, ok := col.Fields[name]
+		if !ok {
+			return fmt.Errorf("unknown field %s", name)
+		}
+		if value == nil {
+			continue
+		}
+		valid := false
+		switch fieldType {
+		case "string", "text":
+			_, valid = value.(string)
+		case "number":
+			_, valid = value.(float64)
+		case "boolean":
+			_, valid = value.(bool)
+		case "date":
+			if s, ok := value.(string); ok {
+				valid = parseDate(s) == nil
+			}
+		default:
+			return fmt.Errorf("field %s has unknown type %s", name, fieldType)
+		}
+		if !valid {
+			return fmt.Errorf("field %s must be a %s", name, fieldType)
+		}
+	}
+	return nil
+}
+
+// parseDate accepts 2006-01-02 and RFC 3339 dates
+func parseDate(s string) error {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return nil
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err
+}
+
+// Record returns the record with slug, or nil
+func (col *Collection) Record(slug string) Record {
+	for _, record := range col.Records {
+		if record.Slug() == slug {
+			return record
+		}
+	}
+	return nil
+}
+
+// PutRecord adds a record, or replaces the record with the same slug
+func (col *Collection) PutRecord(record Record) {
+	for i := range col.Records {
+		if col.Records[i].Slug() == record.Slug() {
+			col.Records[i] = record
+			return
+		}
+	}
+	col.Records = append(col.Records, record)
+}
+
+// DeleteRecord removes the record with slug, reporting whether it existed
+func (col *Collection) DeleteRecord(slug string) bool {
+	for i := range col.Records {
+		if col.Records[i].Slug() == slug {
+			col.Records = append(col.Records[:i], col.Records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Sorted returns the records in the collection's order. Values compare by type first, numbers
+// before strings before booleans, then by value; records without the field come last in either
+// direction. Dates sort correctly as strings.
+func (col *Collection) Sorted() []Record {
+	records := append([]Record(nil), col.Records...)
+	field, descending := strings.CutPrefix(col.Order, "-")
+	if field == "" {
+		return records
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i][field], records[j][field]
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		if descending {
+			return compareValues(b, a) < 0
+		}
+		return compareValues(a, b) < 0
+	})
+	return records
+}
+
+// typeRank orders the JSON types a field can hold
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case float64:
+		return 0
+	case string:
+		return 1
+	case bool:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// compareValues orders field values by type, then value
+func compareValues(a, b interface{}) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+	switch x := a.(type) {
+	case float64:
+		return cmp.Compare(x, b.(float64))
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		if x == b.(bool) {
+			return 0
+		}
+		if x {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// CollectionAt returns the collection served at path, and its name
+func (siteData *SiteData) CollectionAt(path string) (string, *Collection) {
+	for name, col := range siteData.Collections {
+		if col != nil && col.URLPath() == path {
+			return name, col
+		}
+	}
+	return "", nil
+}
+
+// URLPath returns the path records are served under, without surrounding slashes
+func (col *Collection) URLPath() string {
+	return strings.Trim(col.Path, "/")
+}
+
+// ValidateCollections checks every collection's path and records: slugs are unique within a
+// collection, no two collections share a path, and no record URL is taken by a page, which
+// would be rendered instead of the record
+func (siteData *SiteData) ValidateCollections() error {
+	names := make([]string, 0, len(siteData.Collections))
+	for name := range siteData.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	paths := make(map[string]string)
+	for _, name := range names {
+		col := siteData.Collections[name]
+		if col == nil {
+			continue
+		}
+		// collections without a path aren't served, only listed
+		path := col.URLPath()
+		switch {
+		case path == "":
+		case isPattern(path) || strings.Contains(path, "//"):
+			return fmt.Errorf("collection %s: path %q must be literal segments", name, col.Path)
+		case paths[path] != "":
+			return fmt.Errorf("collection %s: path %q is already used by collection %s", name, path, paths[path])
+		default:
+			paths[path] = name
+		}
+
+		seen := make(map[string]bool)
+		for _, record := range col.Records {
+			if err := col.Validate(record); err != nil {
+				return fmt.Errorf("collection %s: record %q: %w", name, record.Slug(), err)
+			}
+			if seen[record.Slug()] {
+				return fmt.Errorf("collection %s: duplicate slug %q", name, record.Slug())
+			}
+			seen[record.Slug()] = true
+			url := path + "/" + record.Slug()
+			if _, taken := siteData.Pages[url]; taken && path != "" {
+				return fmt.Errorf("collection %s: record %q is shadowed by page %s", name, record.Slug(), url)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package pageengine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectionValidate(t *testing.T) {
+	posts := &Collection{Fields: map[string]string{
+		"title":     "string",
+		"body":      "text",
+		"views":     "number",
+		"draft":     "boolean",
+		"published": "date",
+		"mood":      "emoji",
+	}}
+
+	tests := []struct {
+		name    string
+		record  Record
+		wantErr string
+	}{
+		{name: "valid", record: Record{"slug": "hello-world", "title": "Hello", "body": "...", "views": 3.0, "draft": false, "published": "2024-05-01"}},
+		{name: "rfc 3339 date", record: Record{"slug": "a", "published": "2024-05-01T10:00:00Z"}},
+		{name: "null fields are allowed", record: Record{"slug": "a", "title": nil}},
+		{name: "missing slug", record: Record{"title": "Hello"}, wantErr: "slug"},
+		{name: "uppercase slug", record: Record{"slug": "Hello"}, wantErr: "slug"},
+		{name: "slug starting with a dash", record: Record{"slug": "-hello"}, wantErr: "slug"},
+		{name: "unknown field", record: Record{"slug": "a", "author": "me"}, wantErr: "unknown field author"},
+		{name: "string field", record: Record{"slug": "a", "title": 1.0}, wantErr: "title must be a string"},
+		{name: "number field", record: Record{"slug": "a", "views": "3"}, wantErr: "views must be a number"},
+		{name: "boolean field", record: Record{"slug": "a", "draft": "no"}, wantErr: "draft must be a boolean"},
+		{name: "date field", record: Record{"slug": "a", "published": "May 1st"}, wantErr: "published must be a date"},
+		{name: "unknown field type", record: Record{"slug": "a", "mood": "happy"}, wantErr: "unknown type emoji"},
+	}
+	for _, tt := range tests {
+		err := posts.Validate(tt.record)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// without fields any record with a slug is accepted
+	if err := (&Collection{}).Validate(Record{"slug": "a", "anything": 1.0}); err != nil {
+		t.Errorf("collection without fields: %v", err)
+	}
+}
+
+func TestCollectionSorted(t *testing.T) {
+	records := []Record{
+		{"slug": "b", "views": 10.0, "published": "2024-02-01"},
+		{"slug": "a", "views": 9.0, "published": "2024-03-01"},
+		{"slug": "c", "views": 100.0, "published": "2024-01-01"},
+	}
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"", "b a c"},
+		{"slug", "a b c"},
+		{"-slug", "c b a"},
+		{"views", "a b c"}, // numerically, not "10" < "100" < "9"
+		{"-views", "c b a"},
+		{"-published", "a b c"},
+	}
+	for _, tt := range tests {
+		col := &Collection{Order: tt.order, Records: records}
+		var slugs []string
+		for _, record := range col.Sorted() {
+			slugs = append(slugs, record.Slug())
+		}
+		if got := strings.Join(slugs, " "); got != tt.want {
+			t.Errorf("order %q = %s, want %s", tt.order, got, tt.want)
+		}
+	}
+	if records[0].Slug() != "b" {
+		t.Error("Sorted reordered the collection's records")
+	}
+}
+
+func TestCollectionSortedMixedTypes(t *testing.T) {
+	records := []Record{
+		{"slug": "text", "rank": "10"},
+		{"slug": "missing"},
+		{"slug": "yes", "rank": true},
+		{"slug": "two", "rank": 2.0},
+		{"slug": "null", "rank": nil},
+		{"slug": "no", "rank": false},
+		{"slug": "ten", "rank": 10.0},
+	}
+	reversed := make([]Record, len(records))
+	for i, record := range records {
+		reversed[len(records)-1-i] = record
+	}
+
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"rank", "two ten text no yes"},
+		{"-rank", "yes no text ten two"},
+	}
+	for _, tt := range tests {
+		// the same order whichever order the records are in, with the records without a rank last
+		for _, input := range [][]Record{records, reversed} {
+			var slugs []string
+			for _, record := range (&Collection{Order: tt.order, Records: input}).Sorted()[:5] {
+				slugs = append(slugs, record.Slug())
+			}
+			if got := strings.Join(slugs, " "); got != tt.want {
+				t.Errorf("order %q = %s, want %s", tt.order, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCollectionRecords(t *testing.T) {
+	col := &Collection{}
+	col.PutRecord(Record{"slug": "a", "title": "first"})
+	col.PutRecord(Record{"slug": "b"})
+	col.PutRecord(Record{"slug": "a", "title": "second"})
+
+	if len(col.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(col.Records))
+	}
+	if title := col.Record("a")["title"]; title != "second" {
+		t.Fatalf("title = %v, want the replaced record", title)
+	}
+	if !col.DeleteRecord("a") || col.DeleteRecord("a") {
+		t.Fatal("DeleteRecord should report whether the record existed")
+	}
+	if col.Record("a") != nil || col.Record("b") == nil {
+		t.Fatal("deleted the wrong record")
+	}
+}
+
+func TestValidateCollections(t *testing.T) {
+	tests := []struct {
+		name        string
+		collections map[string]*Collection
+		wantErr     string
+	}{
+		{name: "valid", collections: map[string]*Collection{
+			"posts": {Records: []Record{{"slug": "a"}, {"slug": "b"}}},
+			"pages": {Records: []Record{{"slug": "a"}}},
+			"empty": nil,
+		}},
+		{name: "duplicate slug", collections: map[string]*Collection{
+			"posts": {Records: []Record{{"slug": "a"}, {"slug": "a"}}},
+		}, wantErr: `collection posts: duplicate slug "a"`},
+		{name: "invalid record", collections: map[string]*Collection{
+			"posts": {Fields: map[string]string{"title": "string"}, Records: []Record{{"slug": "a", "title": 1.0}}},
+		}, wantErr: `collection posts: record "a": field title must be a string`},
+		{name: "nested paths", collections: map[string]*Collection{
+			"posts": {Path: "/blog/posts/", Records: []Record{{"slug": "about"}}},
+			"news":  {Path: "blog", Records: []Record{{"slug": "posts"}}},
+		}},
+		{name: "pattern path", collections: map[string]*Collection{
+			"posts": {Path: "blog/:year"},
+		}, wantErr: `collection posts: path "blog/:year" must be literal segments`},
+		{name: "shared path", collections: map[string]*Collection{
+			"posts": {Path: "blog"},
+			"news":  {Path: "/blog"},
+		}, wantErr: `collection posts: path "blog" is already used by collection news`},
+		{name: "record shadowed by a page", collections: map[string]*Collection{
+			"posts": {Path: "blog", Records: []Record{{"slug": "archive"}}},
+		}, wantErr: `collection posts: record "archive" is shadowed by page blog/archive`},
+	}
+	pages := map[string]Page{"blog": {}, "blog/archive": {}, "blog/:slug": {}, "about": {}}
+	for _, tt := range tests {
+		err := (&SiteData{Pages: pages, Collections: tt.collections}).ValidateCollections()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
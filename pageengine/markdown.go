@@ -0,0 +1,121 @@
+package pageengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// CommonMark plus tables. goldmark's default (safe) mode drops raw HTML and
+// javascript: style links, so rendered markdown never needs further sanitizing.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Table))
+
+// largest importText response read, in bytes
+const maxImportTextSize = 1 << 20
+
+// MarkdownCache holds rendered markdown by content hash
+type MarkdownCache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+}
+
+// SetMarkdownCache sets where rendered markdown is kept between renders, nil renders it every time
+func (pe *PageEngine) SetMarkdownCache(markdownCache MarkdownCache) {
+	pe.markdownCache = markdownCache
+}
+
+// RenderMarkdown converts markdown to HTML
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// renderMarkdown converts markdown to HTML, through the engine's markdown cache if it has one
+func (pe *PageEngine) renderMarkdown(source string) (string, error) {
+	if pe.markdownCache == nil {
+		return RenderMarkdown(source)
+	}
+	sum := sha256.Sum256([]byte(source))
+	key := hex.EncodeToString(sum[:])
+	if cached, found := pe.markdownCache.Get(key); found {
+		if rendered, ok := cached.(string); ok {
+			return rendered, nil
+		}
+	}
+
+	rendered, err := RenderMarkdown(source)
+	if err != nil {
+		return "", err
+	}
+	pe.markdownCache.Set(key, rendered)
+	return rendered, nil
+}
+
+// elementText returns the text an element renders: its importText source or text,
+// with repeat fields interpolated and markdown converted when textFormat is "markdown"
+func (pe *PageEngine) elementText(p *PageElement) string {
+	text := p.Text
+	if p.ImportText != "" {
+		imported, err := pe.importText(pe.interpolateURL(p.ImportText))
+		if err != nil {
+			log.Printf("Failed to import text from %s: %v", p.ImportText, err)
+			return fmt.Sprintf("<!-- Error: %s -->", strings.ReplaceAll(err.Error(), "--", "- -"))
+		}
+		text = imported
+	}
+
+	if p.TextFormat == "markdown" {
+		// fields go in unescaped: escaping first would break markdown syntax like > quotes and
+		// double escape code spans, and goldmark's safe mode already drops any HTML they contain
+		rendered, err := pe.renderMarkdown(pe.expand(text, func(value string) string { return value }))
+		if err != nil {
+			log.Println(err)
+			return ""
+		}
+		return rendered
+	}
+	return pe.interpolate(text)
+}
+
+// importText returns the text of an internal route's element, or the body of an external url
+func (pe *PageEngine) importText(source string) (string, error) {
+	if strings.HasPrefix(source, "/") {
+		if pe.routeInternal == nil {
+			return "", fmt.Errorf("no internal routes to import %s from", source)
+		}
+		element, err := pe.routeInternal(source, pe.ctx)
+		if err != nil {
+			return "", err
+		}
+		return element.Text, nil
+	}
+
+	req, err := http.NewRequestWithContext(pe.ctx.Request().Context(), "GET", source, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request for %s: %w", source, err)
+	}
+	resp, err := dataClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching %s: %s", source, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImportTextSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading response from %s: %w", source, err)
+	}
+	return string(body), nil
+}
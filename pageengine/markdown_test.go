@@ -0,0 +1,137 @@
+package pageengine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		notWant string
+	}{
+		{name: "commonmark", source: "# Title\n\n*hi*", want: "<h1>Title</h1>\n<p><em>hi</em></p>"},
+		{name: "tables", source: "| a |\n|---|\n| 1 |", want: "<td>1</td>"},
+		{name: "raw html is dropped", source: "<script>alert(1)</script>", notWant: "<script>"},
+		{name: "javascript links are dropped", source: "[x](javascript:alert(1))", notWant: "javascript:"},
+	}
+	for _, tt := range tests {
+		rendered, err := RenderMarkdown(tt.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want != "" && !strings.Contains(rendered, tt.want) {
+			t.Errorf("%s: rendered %q, want %q", tt.name, rendered, tt.want)
+		}
+		if tt.notWant != "" && strings.Contains(rendered, tt.notWant) {
+			t.Errorf("%s: rendered %q", tt.name, rendered)
+		}
+	}
+}
+
+// mapCache is a MarkdownCache whose entries the test can see
+type mapCache map[string]interface{}
+
+func (m mapCache) Get(key string) (interface{}, bool) {
+	value, found := m[key]
+	return value, found
+}
+
+func (m mapCache) Set(key string, value interface{}) {
+	m[key] = value
+}
+
+func TestMarkdownCache(t *testing.T) {
+	page := body(PageElement{Type: "div", TextFormat: "markdown", Text: "# Title"})
+	markdownCache := mapCache{}
+	withCache := func(pe *PageEngine) { pe.SetMarkdownCache(markdownCache) }
+
+	if got := renderedBody(render(t, page, nil, withCache)); got != "<div><h1>Title</h1>\n</div>" {
+		t.Fatalf("rendered %q", got)
+	}
+	if len(markdownCache) != 1 {
+		t.Fatalf("cached %d entries, want 1", len(markdownCache))
+	}
+
+	// the next render is served from the cache
+	for key := range markdownCache {
+		markdownCache[key] = "cached"
+	}
+	if got := renderedBody(render(t, page, nil, withCache)); got != "<div>cached</div>" {
+		t.Errorf("rendered %q, want the cached HTML", got)
+	}
+	// without a cache it is rendered again
+	if got := renderedBody(render(t, page, nil, nil)); got != "<div><h1>Title</h1>\n</div>" {
+		t.Errorf("rendered %q without a cache", got)
+	}
+}
+
+func TestElementText(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readme.md" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("## Imported"))
+	}))
+	defer external.Close()
+
+	tests := []struct {
+		name    string
+		element PageElement
+		record  Record
+		want    string
+	}{
+		{
+			name:    "plain text fields are escaped",
+			element: PageElement{Type: "p", Text: "{{quote}}"},
+			record:  Record{"quote": "> a & b"},
+			want:    "<p>&gt; a &amp; b</p>",
+		},
+		{
+			name:    "markdown fields keep their syntax",
+			element: PageElement{Type: "div", TextFormat: "markdown", Text: "{{quote}}"},
+			record:  Record{"quote": "> a & b"},
+			want:    "<div><blockquote>\n<p>a &amp; b</p>\n</blockquote>\n</div>",
+		},
+		{
+			name:    "markdown code spans are escaped once",
+			element: PageElement{Type: "div", TextFormat: "markdown", Text: "`{{code}}`"},
+			record:  Record{"code": "a < b"},
+			want:    "<div><p><code>a &lt; b</code></p>\n</div>",
+		},
+		{
+			name:    "html in markdown fields is dropped",
+			element: PageElement{Type: "div", TextFormat: "markdown", Text: "{{body}}"},
+			record:  Record{"body": "<img src=x onerror=alert(1)>"},
+			want:    "<div><!-- raw HTML omitted -->\n</div>",
+		},
+		{
+			name:    "imported markdown",
+			element: PageElement{Type: "div", TextFormat: "markdown", ImportText: external.URL + "/readme.md"},
+			want:    "<div><h2>Imported</h2>\n</div>",
+		},
+		{
+			name:    "failed imports are reported inline",
+			element: PageElement{Type: "div", ImportText: external.URL + "/missing.md"},
+			want:    "<div><!-- Error: error fetching " + external.URL + "/missing.md: 404 Not Found --></div>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := render(t, body(tt.element), nil, func(pe *PageEngine) {
+				if tt.record != nil {
+					pe.SetRecord(tt.record)
+				}
+			})
+			got := renderedBody(html)
+			if got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,18 @@
 package pageengine
 
+import (
+	"log"
+	"math/big"
+	"strings"
+)
+
 type SiteData struct {
-	Pages      map[string]Page         `json:"pages"` // Flexible page names
-	Components map[string]*PageElement `json:"components"`
-	IPFSHash   string                  `json:"ipfsHash"`
+	Pages       map[string]Page         `json:"pages"` // Flexible page names
+	Components  map[string]*PageElement `json:"components"`
+	IPFSHash    string                  `json:"ipfsHash"`
+	Data        map[string]interface{}  `json:"data,omitempty"`        // site level data for repeats, ex: "data:team"
+	Collections map[string]*Collection  `json:"collections,omitempty"` // typed records like blog posts, see Collection
+	Maintenance bool                    `json:"maintenance,omitempty"` // visitors get the maintenance page (503), collaborators the site
 }
 
 type Page struct {
@@ -11,6 +20,28 @@ type Page struct {
 	Body              Section `json:"body"`
 	RedirectForLogin  string  `json:"redirectForLogin,omitempty"`  // URL to redirect if session is active
 	RedirectForLogout string  `json:"redirectForLogout,omitempty"` // URL to redirect if session is inactive
+	Gate              *Gate   `json:"gate,omitempty"`              // only token holders may view the page
+}
+
+// Gate restricts a page or element to viewers whose wallet holds at least MinBalance of a token
+type Gate struct {
+	Standard   string       `json:"standard"`             // "erc20" or "erc721"
+	Contract   string       `json:"contract"`             // token contract address
+	MinBalance string       `json:"minBalance,omitempty"` // in the token's smallest unit, defaults to 1
+	Fallback   *PageElement `json:"fallback,omitempty"`   // rendered to viewers who don't qualify
+	Redirect   string       `json:"redirect,omitempty"`   // pages only: URL to send viewers who don't qualify
+}
+
+// Min returns the balance a viewer needs, or nil if MinBalance is not a number
+func (g *Gate) Min() *big.Int {
+	if g.MinBalance == "" {
+		return big.NewInt(1)
+	}
+	min, ok := new(big.Int).SetString(g.MinBalance, 10)
+	if !ok {
+		return nil
+	}
+	return min
 }
 
 type Meta struct {
@@ -29,11 +60,75 @@ type PageElement struct {
 	Style      map[string]string `json:"style,omitempty"`      // For CSS styling properties
 	Import     string            `json:"import,omitempty"`     // import component from internal or external source
 	ImportText string            `json:"importText,omitempty"` // use response from internal or external source as text
+	TextFormat string            `json:"textFormat,omitempty"` // "markdown" renders text (or imported text) as markdown
 	Private    bool              `json:"private,omitempty"`    // For private components. Will never show in /components export
 	Pid        string            `json:"pid,omitempty"`        // For previewing components
+	Gate       *Gate             `json:"gate,omitempty"`       // only render for token holders
+	If         string            `json:"if,omitempty"`         // only render when the condition holds
+	Unless     string            `json:"unless,omitempty"`     // only render when the condition doesn't hold
+	Repeat     *Repeat           `json:"repeat,omitempty"`     // render the child elements once per item of a data source
+}
+
+// RenderContext is what if/unless conditions are evaluated against:
+//
+//	loggedIn      the viewer is logged in
+//	preview       the page is rendered in preview mode
+//	owner         the viewer owns the current site
+//	query:<name>  the request has the query parameter <name>, query:<name>=<value> for a value
+//	param:<name>  the page's path pattern captured a non-empty <name>, param:<name>=<value> for a value
+//	page:<name>   the page being rendered is <name>
+type RenderContext struct {
+	LoggedIn bool
+	Preview  bool
+	Owner    bool
+	Page     string
+	Query    map[string][]string
+	Params   map[string]string // captured by the page's path pattern, ex: slug for blog/:slug
 }
 
 type Message struct {
 	Message string
 	Type    string
 }
+
+// Holds evaluates a single condition. Unknown conditions never hold.
+func (rc *RenderContext) Holds(condition string) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(condition), ":")
+	switch name {
+	case "loggedIn":
+		return rc.LoggedIn
+	case "preview":
+		return rc.Preview
+	case "owner":
+		return rc.Owner
+	case "query":
+		key, value, hasValue := strings.Cut(arg, "=")
+		values, ok := rc.Query[key]
+		if !hasValue {
+			return ok
+		}
+		return ok && len(values) > 0 && values[0] == value
+	case "param":
+		key, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue {
+			return rc.Params[key] != ""
+		}
+		return rc.Params[key] == value
+	case "page":
+		return rc.Page == arg
+	}
+	log.Println("Unknown render condition:", condition)
+	return false
+}
+
+// viewerDependent reports whether an element's conditions can differ between
+// visitors of the same page. page:<name> and param:<name> conditions can't, cached pages are keyed by path.
+func (p *PageElement) viewerDependent() bool {
+	for _, condition := range []string{p.If, p.Unless} {
+		condition = strings.TrimSpace(condition)
+		if condition != "" && !strings.HasPrefix(condition, "page:") && !strings.HasPrefix(condition, "param:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package pageengine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderContextHolds(t *testing.T) {
+	rc := &RenderContext{
+		LoggedIn: true,
+		Owner:    false,
+		Page:     "blog/:slug",
+		Query:    map[string][]string{"ref": {"mail"}, "debug": {""}},
+		Params:   map[string]string{"slug": "hello", "empty": ""},
+	}
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"loggedIn", true},
+		{" loggedIn ", true},
+		{"owner", false},
+		{"preview", false},
+		{"query:ref", true},
+		{"query:ref=mail", true},
+		{"query:ref=web", false},
+		{"query:debug", true},
+		{"query:missing", false},
+		{"param:slug", true},
+		{"param:slug=hello", true},
+		{"param:slug=other", false},
+		{"param:empty", false},
+		{"page:blog/:slug", true},
+		{"page:home", false},
+		{"admin", false},
+	}
+	for _, tt := range tests {
+		if got := rc.Holds(tt.condition); got != tt.want {
+			t.Errorf("Holds(%q) = %v, want %v", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestConditionalElements(t *testing.T) {
+	page := body(
+		PageElement{Type: "p", Text: "always"},
+		PageElement{Type: "p", Text: "welcome back", If: "loggedIn"},
+		PageElement{Type: "p", Text: "please log in", Unless: "loggedIn"},
+		PageElement{Type: "p", Text: "from the newsletter", If: "query:ref=mail", Unless: "owner"},
+	)
+
+	tests := []struct {
+		name string
+		rc   *RenderContext
+		want []string
+	}{
+		{name: "without a context conditional elements are hidden", want: []string{"always"}},
+		{name: "visitor", rc: &RenderContext{}, want: []string{"always", "please log in"}},
+		{name: "logged in", rc: &RenderContext{LoggedIn: true}, want: []string{"always", "welcome back"}},
+		{name: "both conditions", rc: &RenderContext{Query: map[string][]string{"ref": {"mail"}}}, want: []string{"always", "please log in", "from the newsletter"}},
+		{name: "unless wins", rc: &RenderContext{Owner: true, Query: map[string][]string{"ref": {"mail"}}}, want: []string{"always", "please log in"}},
+	}
+	all := []string{"always", "welcome back", "please log in", "from the newsletter"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := render(t, page, nil, func(pe *PageEngine) { pe.SetRenderContext(tt.rc) })
+			var rendered []string
+			for _, text := range all {
+				if strings.Contains(html, text) {
+					rendered = append(rendered, text)
+				}
+			}
+			if strings.Join(rendered, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("rendered %v, want %v", rendered, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		name string
+		page Page
+		want bool
+	}{
+		{"no conditions", body(PageElement{Type: "p"}), false},
+		{"page conditions are the same for every viewer", body(PageElement{If: "page:home"}), false},
+		{"param conditions are the same for every viewer", body(PageElement{Unless: "param:slug=draft"}), false},
+		{"viewer conditions", body(PageElement{If: "loggedIn"}), true},
+		{"query conditions", body(PageElement{Unless: "query:ref"}), true},
+		{"nested", body(PageElement{Elements: []PageElement{{If: "owner"}}}), true},
+	}
+	for _, tt := range tests {
+		if got := tt.page.Conditional(nil); got != tt.want {
+			t.Errorf("%s: Conditional = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -41,9 +41,40 @@ func generateRandomClassName(n int) string {
 	return string(b)
 }
 
+// passesGate asks the engine's gate checker whether the viewer may see gated content. Without a checker nothing gated is shown.
+func (pe *PageEngine) passesGate(gate *Gate) bool {
+	if gate == nil {
+		return true
+	}
+	if pe.gateChecker == nil {
+		return false
+	}
+	return pe.gateChecker(gate)
+}
+
+// shown evaluates an element's if/unless conditions. Without a render context conditional elements are hidden.
+func (pe *PageEngine) shown(p *PageElement) bool {
+	if p.If == "" && p.Unless == "" {
+		return true
+	}
+	if pe.renderContext == nil {
+		return false
+	}
+	if p.If != "" && !pe.renderContext.Holds(p.If) {
+		return false
+	}
+	return p.Unless == "" || !pe.renderContext.Holds(p.Unless)
+}
+
 // Recursive function that collects CSS first and assigns class names
 func (pe *PageEngine) CollectCSS(p *PageElement, classMap map[*PageElement]string, visited map[string]bool, routeInternal func(string, echo.Context) (*PageElement, error)) {
-	if p == nil {
+	if p == nil || !pe.shown(p) {
+		return
+	}
+
+	// viewers who fail a gate get its fallback instead
+	if !pe.passesGate(p.Gate) {
+		pe.CollectCSS(p.Gate.Fallback, classMap, visited, routeInternal)
 		return
 	}
 
@@ -116,6 +147,9 @@ func (pe *PageEngine) CollectCSS(p *PageElement, classMap map[*PageElement]strin
 	for i := range p.Elements {
 		pe.CollectCSS(&p.Elements[i], classMap, visited, routeInternal)
 	}
+	if p.Repeat != nil {
+		pe.CollectCSS(p.Repeat.Empty, classMap, visited, routeInternal)
+	}
 }
 
 // Generate and write CSS styles directly to `styleWriter`
@@ -188,7 +222,7 @@ func (pe *PageEngine) GetExternalComponent(uri string, routeInternal func(string
 // Stream HTML directly using pre-assigned class names
 // Stream HTML directly using pre-assigned class names
 func (p *PageElement) RenderElement(pe *PageEngine, classMap map[*PageElement]string, visited map[string]bool, previewElementMap map[string]*PageElement, nonce string) {
-	if p == nil {
+	if p == nil || !pe.shown(p) {
 		return
 	}
 
@@ -202,6 +236,11 @@ func (p *PageElement) RenderElement(pe *PageEngine, classMap map[*PageElement]st
 		}
 	}
 
+	if !pe.passesGate(p.Gate) {
+		p.Gate.Fallback.RenderElement(pe, classMap, visited, previewElementMap, nonce)
+		return
+	}
+
 	// Handle imported components
 	if p.Import != "" {
 		// Prevent circular dependencies
@@ -255,7 +294,7 @@ func (p *PageElement) RenderElement(pe *PageEngine, classMap map[*PageElement]st
 			clonedComponent.RenderElement(pe, classMap, visited, previewElementMap, nonce)
 
 			// Allow reuse in different parts of the page by removing visit lock
-			delete(visited, p.Import)
+			delete(visited, visitKey)
 
 			// If component is marked as private, delete after use
 			if p.Private {
@@ -284,6 +323,7 @@ func (p *PageElement) RenderElement(pe *PageEngine, classMap map[*PageElement]st
 	// Process attributes
 	var customClass string
 	for key, value := range p.Attributes {
+		value = pe.interpolate(value)
 		if key == "class" {
 			customClass = value
 			continue
@@ -315,26 +355,62 @@ func (p *PageElement) RenderElement(pe *PageEngine, classMap map[*PageElement]st
 	fmt.Fprint(pe.writer, ">")
 
 	// Print text content if present
-	if p.Text != "" {
-		fmt.Fprint(pe.writer, p.Text)
+	if p.Text != "" || p.ImportText != "" {
+		fmt.Fprint(pe.writer, pe.elementText(p))
 	}
 
-	// Recursively render child elements
-	for i := range p.Elements {
-		p.Elements[i].RenderElement(pe, classMap, visited, previewElementMap, nonce)
+	// Recursively render child elements, once per item for repeats
+	if p.Repeat != nil {
+		p.renderRepeat(pe, classMap, visited, previewElementMap, nonce)
+	} else {
+		for i := range p.Elements {
+			p.Elements[i].RenderElement(pe, classMap, visited, previewElementMap, nonce)
+		}
 	}
 
 	// Close HTML tag
 	fmt.Fprintf(pe.writer, "</%s>", p.Type)
 }
 
-// routeInternal is a function
-func (pe *PageEngine) RenderPage(pageData Page, routeInternal func(string, echo.Context) (*PageElement, error), previewElementMap map[string]*PageElement) error {
+// errWriter keeps the first write error and drops everything written after it
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(b []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(b)
+	ew.err = err
+	return n, err
+}
+
+// RenderPage writes a page as HTML. It returns an error if writing fails or rendering panics, in which
+// case the output is incomplete; render into a buffer to be able to show an error page instead.
+// Sources that fail to load (imports, repeats) are reported inline as comments and don't fail the page.
+func (pe *PageEngine) RenderPage(pageData Page, routeInternal func(string, echo.Context) (*PageElement, error), previewElementMap map[string]*PageElement) (err error) {
 	// map a pid value to a page element so we can target them in the preview
 
 	fmt.Println("rendering page. previewElementMap enabled:", previewElementMap != nil)
 
-	nonce := generateNonce()
+	ew := &errWriter{w: pe.writer}
+	pe.writer = ew
+	defer func() {
+		pe.writer = ew.w
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rendering page panicked: %v", r)
+		} else if ew.err != nil {
+			err = fmt.Errorf("failed to write page: %w", ew.err)
+		}
+	}()
+
+	nonce := pe.nonce
+	if nonce == "" {
+		nonce = generateNonce()
+	}
+	pe.routeInternal = routeInternal
 
 	// Start streaming HTML immediately
 	fmt.Fprint(pe.writer, "<!DOCTYPE html><html><head>")
@@ -372,16 +448,134 @@ func (pe *PageEngine) RenderPage(pageData Page, routeInternal func(string, echo.
 }
 
 type PageEngine struct {
-	ctx        echo.Context
-	writer     io.Writer
-	components map[string]*PageElement
+	ctx           echo.Context
+	writer        io.Writer
+	components    map[string]*PageElement
+	gateChecker   func(*Gate) bool
+	renderContext *RenderContext
+	routeInternal func(string, echo.Context) (*PageElement, error)
+	dataSource    func(string) (interface{}, error)
+	markdownCache MarkdownCache
+	data          map[string]interface{} // repeat sources loaded during this render
+	items         []interface{}          // repeat items being rendered, innermost last
+	nonce         string                 // for inline styles and scripts, random per render unless set
+}
+
+// SetNonce sets the nonce inline styles and scripts are rendered with, e.g. a placeholder
+// for HTML that is cached and given a fresh nonce each time it is served
+func (pe *PageEngine) SetNonce(nonce string) {
+	pe.nonce = nonce
+}
+
+// NewNonce returns a random nonce for inline styles and scripts
+func NewNonce() string {
+	return generateNonce()
+}
+
+// SetGateChecker sets how the engine decides whether the viewer passes an element's gate
+func (pe *PageEngine) SetGateChecker(checker func(*Gate) bool) {
+	pe.gateChecker = checker
+}
+
+// SetRenderContext sets what the engine evaluates if/unless conditions against
+func (pe *PageEngine) SetRenderContext(rc *RenderContext) {
+	pe.renderContext = rc
 }
 
 // NewPageEngine initializes an instance with request-specific context
 func NewPageEngine(context echo.Context, comps map[string]*PageElement) *PageEngine {
+	return NewPageEngineWriter(context, comps, context.Response().Writer)
+}
+
+// NewPageEngineWriter initializes an instance that renders into w instead of the response
+func NewPageEngineWriter(context echo.Context, comps map[string]*PageElement, w io.Writer) *PageEngine {
 	return &PageEngine{
 		ctx:        context,
-		writer:     context.Response().Writer,
+		writer:     w,
 		components: comps,
 	}
 }
+
+// Gated reports whether a page, or anything it renders, is token gated
+func (pageData Page) Gated(components map[string]*PageElement) bool {
+	return pageData.Gate != nil || pageData.anyElement(components, func(p *PageElement) bool { return p.Gate != nil })
+}
+
+// Conditional reports whether a page renders differently depending on who views it, because of if/unless conditions
+func (pageData Page) Conditional(components map[string]*PageElement) bool {
+	return pageData.anyElement(components, (*PageElement).viewerDependent)
+}
+
+// anyElement reports whether match holds for any element a page can render
+func (pageData Page) anyElement(components map[string]*PageElement, match func(*PageElement) bool) bool {
+	found := false
+	pageData.walk(components, func(p *PageElement) bool {
+		found = match(p)
+		return !found
+	})
+	return found
+}
+
+// walk calls visit for every element a page can render, depth first, until visit returns false. Besides
+// children it follows imports of local components, gate fallbacks and the elements of empty repeats.
+func (pageData Page) walk(components map[string]*PageElement, visit func(*PageElement) bool) {
+	seen := make(map[string]bool)
+
+	var walkElement func(p *PageElement) bool
+	walkElements := func(elements []PageElement) bool {
+		for i := range elements {
+			if !walkElement(&elements[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	walkElement = func(p *PageElement) bool {
+		if p == nil {
+			return true
+		}
+		if !visit(p) {
+			return false
+		}
+		if component, ok := components[p.Import]; ok && component != nil && !seen[p.Import] {
+			seen[p.Import] = true
+			if !walkElement(component) {
+				return false
+			}
+		}
+		if p.Gate != nil && !walkElement(p.Gate.Fallback) {
+			return false
+		}
+		if p.Repeat != nil && !walkElement(p.Repeat.Empty) {
+			return false
+		}
+		return walkElements(p.Elements)
+	}
+
+	if pageData.Gate != nil && !walkElement(pageData.Gate.Fallback) {
+		return
+	}
+	if walkElements(pageData.Head.Elements) {
+		walkElements(pageData.Body.Elements)
+	}
+}
+
+// Imports returns every import, importText and repeat source reachable from a page
+func (pageData Page) Imports(components map[string]*PageElement) []string {
+	var imports []string
+	seen := make(map[string]bool)
+	pageData.walk(components, func(p *PageElement) bool {
+		sources := []string{p.Import, p.ImportText}
+		if p.Repeat != nil {
+			sources = append(sources, p.Repeat.Source)
+		}
+		for _, source := range sources {
+			if source != "" && !seen[source] {
+				seen[source] = true
+				imports = append(imports, source)
+			}
+		}
+		return true
+	})
+	return imports
+}
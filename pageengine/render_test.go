@@ -0,0 +1,212 @@
+package pageengine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// render renders page into a string, after setup configured the engine
+func render(t *testing.T, page Page, components map[string]*PageElement, setup func(pe *PageEngine)) string {
+	t.Helper()
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+	var buf bytes.Buffer
+	pe := NewPageEngineWriter(c, components, &buf)
+	pe.SetNonce("nonce")
+	if setup != nil {
+		setup(pe)
+	}
+	if err := pe.RenderPage(page, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// class names generated for element styles, which differ on every render
+var generatedClass = regexp.MustCompile(` class="[a-z0-9]+_[A-Za-z]+"`)
+
+// renderedBody returns what a page rendered inside <body>, without generated class names
+func renderedBody(html string) string {
+	_, inside, _ := strings.Cut(html, "<body>")
+	return generatedClass.ReplaceAllString(strings.TrimSuffix(inside, "</body></html>"), "")
+}
+
+// body wraps elements in a page
+func body(elements ...PageElement) Page {
+	return Page{Body: Section{Elements: elements}}
+}
+
+func TestGatedElements(t *testing.T) {
+	gate := func(fallback *PageElement) *Gate {
+		return &Gate{Standard: "erc721", Contract: "0x0000000000000000000000000000000000000001", Fallback: fallback}
+	}
+	page := body(
+		PageElement{Type: "p", Text: "public"},
+		PageElement{Type: "p", Text: "members only", Gate: gate(&PageElement{Type: "p", Text: "join to read"})},
+		PageElement{Type: "p", Text: "hidden", Gate: gate(nil)},
+	)
+
+	tests := []struct {
+		name    string
+		checker func(*Gate) bool
+		want    []string
+		notWant []string
+	}{
+		{name: "without a checker gated content is hidden", want: []string{"public", "join to read"}, notWant: []string{"members only", "hidden"}},
+		{name: "viewers who don't qualify see fallbacks", checker: func(*Gate) bool { return false }, want: []string{"public", "join to read"}, notWant: []string{"members only", "hidden"}},
+		{name: "holders see gated content", checker: func(*Gate) bool { return true }, want: []string{"public", "members only", "hidden"}, notWant: []string{"join to read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := render(t, page, nil, func(pe *PageEngine) { pe.SetGateChecker(tt.checker) })
+			for _, text := range tt.want {
+				if !strings.Contains(html, text) {
+					t.Errorf("%q missing from %s", text, html)
+				}
+			}
+			for _, text := range tt.notWant {
+				if strings.Contains(html, text) {
+					t.Errorf("%q rendered in %s", text, html)
+				}
+			}
+		})
+	}
+}
+
+func TestGateMin(t *testing.T) {
+	tests := []struct {
+		minBalance string
+		want       string
+	}{
+		{"", "1"},
+		{"0", "0"},
+		{"1000000000000000000000", "1000000000000000000000"},
+		{"1e18", "<nil>"},
+		{"-", "<nil>"},
+	}
+	for _, tt := range tests {
+		if got := (&Gate{MinBalance: tt.minBalance}).Min().String(); got != tt.want {
+			t.Errorf("Min(%q) = %s, want %s", tt.minBalance, got, tt.want)
+		}
+	}
+}
+
+func TestPageWalk(t *testing.T) {
+	gated := &Gate{Standard: "erc20", Contract: "0x0000000000000000000000000000000000000001"}
+	components := map[string]*PageElement{
+		"card":   {Type: "div", Elements: []PageElement{{Type: "span", Gate: gated}}},
+		"loop":   {Type: "div", Import: "loop"},
+		"remote": {Type: "div", ImportText: "https://example.com/text.md"},
+	}
+
+	tests := []struct {
+		name        string
+		page        Page
+		wantGated   bool
+		wantImports []string
+	}{
+		{name: "plain", page: body(PageElement{Type: "p"})},
+		{name: "page gate", page: Page{Gate: gated}, wantGated: true},
+		{name: "nested element", page: body(PageElement{Type: "div", Elements: []PageElement{{Type: "p", Gate: gated}}}), wantGated: true},
+		{name: "head element", page: Page{Head: Section{Elements: []PageElement{{Type: "meta", Gate: gated}}}}, wantGated: true},
+		{name: "imported component", page: body(PageElement{Import: "card"}), wantGated: true, wantImports: []string{"card"}},
+		{
+			name:        "page gate fallback",
+			page:        Page{Gate: &Gate{Fallback: &PageElement{Import: "card"}}},
+			wantGated:   true,
+			wantImports: []string{"card"},
+		},
+		{
+			name:        "element gate fallback",
+			page:        body(PageElement{Gate: &Gate{Fallback: &PageElement{Import: "remote"}}}),
+			wantGated:   true,
+			wantImports: []string{"remote", "https://example.com/text.md"},
+		},
+		{
+			name:        "empty repeat",
+			page:        body(PageElement{Repeat: &Repeat{Source: "data:posts", Empty: &PageElement{Import: "card"}}}),
+			wantGated:   true,
+			wantImports: []string{"data:posts", "card"},
+		},
+		{name: "import cycle", page: body(PageElement{Import: "loop"}), wantImports: []string{"loop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.page.Gated(components); got != tt.wantGated {
+				t.Errorf("Gated = %v, want %v", got, tt.wantGated)
+			}
+			if got := tt.page.Imports(components); strings.Join(got, " ") != strings.Join(tt.wantImports, " ") {
+				t.Errorf("Imports = %v, want %v", got, tt.wantImports)
+			}
+		})
+	}
+}
+
+// failingWriter accepts n bytes, then fails
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		written := w.n
+		w.n = 0
+		return written, errors.New("connection reset")
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestRenderPageErrors(t *testing.T) {
+	gated := body(PageElement{Type: "p", Gate: &Gate{}})
+
+	tests := []struct {
+		name    string
+		writer  io.Writer
+		checker func(*Gate) bool
+		wantErr string
+	}{
+		{name: "renders", writer: io.Discard},
+		{name: "write failure", writer: &failingWriter{n: 20}, wantErr: "failed to write page: connection reset"},
+		{name: "panic", writer: io.Discard, checker: func(*Gate) bool { panic("boom") }, wantErr: "rendering page panicked: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+			pe := NewPageEngineWriter(c, nil, tt.writer)
+			pe.SetGateChecker(tt.checker)
+			err := pe.RenderPage(gated, nil, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderPageNonce(t *testing.T) {
+	page := Page{Head: Section{Elements: []PageElement{{Type: "script", Text: "run()"}}}}
+	html := render(t, page, nil, func(pe *PageEngine) { pe.SetNonce("placeholder") })
+	if strings.Count(html, `nonce="placeholder"`) != 2 {
+		t.Fatalf("inline script and style should carry the set nonce: %s", html)
+	}
+
+	html = render(t, page, nil, func(pe *PageEngine) { pe.SetNonce("") })
+	if strings.Contains(html, `nonce=""`) {
+		t.Fatalf("rendered an empty nonce: %s", html)
+	}
+	if NewNonce() == NewNonce() {
+		t.Fatal("nonces repeat")
+	}
+}
@@ -0,0 +1,227 @@
+package pageengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repeat renders an element's children once per item of an array from a data source
+type Repeat struct {
+	Source string       `json:"source"`          // "data:<name>" for site data, "collection:<name>", an internal route like /mysites, or an external JSON URL
+	Path   string       `json:"path,omitempty"`  // dot separated path to the array within the source, ex: "posts"
+	Limit  int          `json:"limit,omitempty"` // render at most this many items
+	Empty  *PageElement `json:"empty,omitempty"` // rendered instead when there are no items
+}
+
+// {{field}}, {{field.nested}}, {{.}} for the item itself or {{params.name}} for a path parameter
+var fieldPattern = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+var dataClient = &http.Client{Timeout: 10 * time.Second}
+
+// SetDataSource sets how the engine loads repeat sources other than external URLs
+func (pe *PageEngine) SetDataSource(source func(string) (interface{}, error)) {
+	pe.dataSource = source
+}
+
+// SetRecord binds a collection record to the whole page, for {{field}} outside of repeats
+func (pe *PageEngine) SetRecord(record Record) {
+	pe.items = []interface{}{map[string]interface{}(record)}
+}
+
+// loadData returns a repeat source, loading each source once per render
+func (pe *PageEngine) loadData(source string) (interface{}, error) {
+	if data, ok := pe.data[source]; ok {
+		return data, nil
+	}
+
+	var data interface{}
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = pe.GetExternalData(source)
+	} else if pe.dataSource != nil {
+		data, err = pe.dataSource(source)
+	} else {
+		err = fmt.Errorf("no data source for %s", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pe.data == nil {
+		pe.data = make(map[string]interface{})
+	}
+	pe.data[source] = data
+	return data, nil
+}
+
+// GetExternalData fetches and decodes a JSON document. Unlike external components,
+// the viewer's headers are not forwarded, data sources are usually third party APIs.
+func (pe *PageEngine) GetExternalData(uri string) (interface{}, error) {
+	log.Println("Fetching external data:", uri)
+	req, err := http.NewRequestWithContext(pe.ctx.Request().Context(), "GET", uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", uri, err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := dataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: %s", uri, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from %s: %w", uri, err)
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("error decoding JSON from %s: %w", uri, err)
+	}
+	return data, nil
+}
+
+// repeatItems returns the items a repeat iterates over
+func (pe *PageEngine) repeatItems(r *Repeat) ([]interface{}, error) {
+	data, err := pe.loadData(pe.interpolateURL(r.Source))
+	if err != nil {
+		return nil, err
+	}
+	// round trip typed data (e.g. from internal routes) so lookups only deal with maps and slices
+	if _, generic := data.([]interface{}); !generic {
+		if _, generic := data.(map[string]interface{}); !generic {
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(encoded, &data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, _ := lookup(data, r.Path)
+	items, ok := value.([]interface{})
+	if !ok {
+		if value == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s %s is not an array", r.Source, r.Path)
+	}
+	if r.Limit > 0 && len(items) > r.Limit {
+		items = items[:r.Limit]
+	}
+	return items, nil
+}
+
+// lookup follows a dot separated path through maps and arrays. "" and "." return value itself.
+func lookup(value interface{}, path string) (interface{}, bool) {
+	if path == "" || path == "." {
+		return value, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// interpolate replaces {{field}} placeholders with the current repeat item's (or the page's record's) fields
+// and path parameters, HTML escaped
+func (pe *PageEngine) interpolate(s string) string {
+	return pe.expand(s, html.EscapeString)
+}
+
+// interpolateURL fills in a data source url, escaping values as path segments
+func (pe *PageEngine) interpolateURL(s string) string {
+	return pe.expand(s, func(value string) string {
+		segments := strings.Split(value, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		return strings.Join(segments, "/")
+	})
+}
+
+func (pe *PageEngine) expand(s string, escape func(string) string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return fieldPattern.ReplaceAllStringFunc(s, func(match string) string {
+		path := fieldPattern.FindStringSubmatch(match)[1]
+		if len(pe.items) == 0 && !strings.HasPrefix(path, "params.") {
+			return match // outside of repeats and record pages fields are left as written
+		}
+		value, ok := pe.field(path)
+		if !ok || value == nil {
+			return ""
+		}
+		switch v := value.(type) {
+		case string:
+			return escape(v)
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(v)
+			return escape(string(encoded))
+		default:
+			return escape(fmt.Sprint(v))
+		}
+	})
+}
+
+// field resolves a placeholder against path parameters or the innermost repeat item
+func (pe *PageEngine) field(path string) (interface{}, bool) {
+	if name, ok := strings.CutPrefix(path, "params."); ok {
+		if pe.renderContext == nil {
+			return nil, false
+		}
+		value, ok := pe.renderContext.Params[name]
+		return value, ok
+	}
+	return lookup(pe.items[len(pe.items)-1], path)
+}
+
+// renderRepeat renders p's children once per item, or p.Repeat.Empty when there are none
+func (p *PageElement) renderRepeat(pe *PageEngine, classMap map[*PageElement]string, visited map[string]bool, previewElementMap map[string]*PageElement, nonce string) {
+	items, err := pe.repeatItems(p.Repeat)
+	if err != nil {
+		log.Printf("Failed to load repeat source %s: %v", p.Repeat.Source, err)
+		fmt.Fprintf(pe.writer, "<!-- Error: %s -->", html.EscapeString(err.Error()))
+	}
+	if len(items) == 0 {
+		p.Repeat.Empty.RenderElement(pe, classMap, visited, previewElementMap, nonce)
+		return
+	}
+	for _, item := range items {
+		pe.items = append(pe.items, item)
+		for i := range p.Elements {
+			p.Elements[i].RenderElement(pe, classMap, visited, previewElementMap, nonce)
+		}
+		pe.items = pe.items[:len(pe.items)-1]
+	}
+}
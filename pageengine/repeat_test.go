@@ -0,0 +1,162 @@
+package pageengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{"team": {"members": [{"name": "Ada"}, {"name": "Grace"}]}, "count": 2}`), &data)
+
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"count", "2", true},
+		{"team.members.1.name", "Grace", true},
+		{"team.members.2.name", "<nil>", false},
+		{"team.members.-1", "<nil>", false},
+		{"team.members.first", "<nil>", false},
+		{"count.value", "<nil>", false},
+		{"missing", "<nil>", false},
+	}
+	for _, tt := range tests {
+		value, ok := lookup(data, tt.path)
+		if ok != tt.wantOK || fmt.Sprint(value) != tt.want {
+			t.Errorf("lookup(%q) = %v, %v, want %s, %v", tt.path, value, ok, tt.want, tt.wantOK)
+		}
+	}
+	if value, ok := lookup(data, "."); !ok || value == nil {
+		t.Error(`lookup(".") should return the value itself`)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/posts.json":
+			w.Write([]byte(`{"posts": [{"title": "From the API"}]}`))
+		case "/tags/c++ & go?":
+			w.Write([]byte(`["escaped"]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer external.Close()
+
+	site := map[string]interface{}{
+		"data:team": []interface{}{
+			map[string]interface{}{"name": "Ada", "role": "<b>lead</b>", "skills": []interface{}{"math", "engines"}},
+			map[string]interface{}{"name": "Grace"},
+		},
+		"data:config": map[string]interface{}{"title": "not a list"},
+	}
+	dataSource := func(source string) (interface{}, error) {
+		if data, ok := site[source]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("unknown source %s", source)
+	}
+	item := func(text string) PageElement { return PageElement{Type: "li", Text: text} }
+
+	tests := []struct {
+		name    string
+		element PageElement
+		record  Record
+		params  map[string]string
+		want    string
+	}{
+		{
+			name:    "site data",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team"}, Elements: []PageElement{item("{{name}}")}},
+			want:    "<ul><li>Ada</li><li>Grace</li></ul>",
+		},
+		{
+			name:    "fields are escaped and missing fields empty",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team"}, Elements: []PageElement{item("{{role}}")}},
+			want:    "<ul><li>&lt;b&gt;lead&lt;/b&gt;</li><li></li></ul>",
+		},
+		{
+			name:    "limit",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team", Limit: 1}, Elements: []PageElement{item("{{name}}")}},
+			want:    "<ul><li>Ada</li></ul>",
+		},
+		{
+			name:    "paths into the source and the item itself",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team", Path: "0.skills"}, Elements: []PageElement{item("{{.}}")}},
+			want:    "<ul><li>math</li><li>engines</li></ul>",
+		},
+		{
+			name:    "empty",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team", Path: "2.skills", Empty: &PageElement{Type: "p", Text: "nobody yet"}}},
+			want:    "<ul><p>nobody yet</p></ul>",
+		},
+		{
+			name:    "not an array",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:config", Path: "title"}},
+			want:    "<ul><!-- Error: data:config title is not an array --></ul>",
+		},
+		{
+			name:    "unknown source",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: "data:missing"}},
+			want:    "<ul><!-- Error: unknown source data:missing --></ul>",
+		},
+		{
+			name:    "external json",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: external.URL + "/posts.json", Path: "posts"}, Elements: []PageElement{item("{{title}}")}},
+			want:    "<ul><li>From the API</li></ul>",
+		},
+		{
+			name:    "source urls are filled in from path parameters, escaped",
+			element: PageElement{Type: "ul", Repeat: &Repeat{Source: external.URL + "/tags/{{params.tag}}"}, Elements: []PageElement{item("{{.}}")}},
+			params:  map[string]string{"tag": "c++ & go?"},
+			want:    "<ul><li>escaped</li></ul>",
+		},
+		{
+			name:    "record pages",
+			element: PageElement{Type: "h1", Text: "{{title}} by {{author.name}}"},
+			record:  Record{"slug": "hello", "title": "Hello & welcome", "author": map[string]interface{}{"name": "Ada"}},
+			want:    "<h1>Hello &amp; welcome by Ada</h1>",
+		},
+		{
+			name:    "outside of repeats fields are left as written",
+			element: PageElement{Type: "p", Text: "{{name}} {{params.slug}}"},
+			params:  map[string]string{"slug": "hello"},
+			want:    "<p>{{name}} hello</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := render(t, body(tt.element), nil, func(pe *PageEngine) {
+				pe.SetDataSource(dataSource)
+				pe.SetRenderContext(&RenderContext{Params: tt.params})
+				if tt.record != nil {
+					pe.SetRecord(tt.record)
+				}
+			})
+			got := renderedBody(html)
+			if got != tt.want {
+				t.Errorf("rendered %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepeatLoadsSourcesOnce(t *testing.T) {
+	loads := 0
+	element := PageElement{Type: "ul", Repeat: &Repeat{Source: "data:team"}, Elements: []PageElement{{Type: "li", Text: "{{.}}"}}}
+	render(t, body(element, element), nil, func(pe *PageEngine) {
+		pe.SetDataSource(func(string) (interface{}, error) {
+			loads++
+			return []interface{}{"a"}, nil
+		})
+	})
+	if loads != 1 {
+		t.Fatalf("loaded the source %d times, want once per render", loads)
+	}
+}
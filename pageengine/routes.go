@@ -0,0 +1,158 @@
+package pageengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Page keys are either plain names ("about") or path patterns:
+//
+//	blog/:slug   :name captures one path segment
+//	docs/*path   *name captures the rest of the path, possibly empty, and must come last
+//
+// A path is matched, in order, by:
+//  1. the page whose key equals the path ("" is "home")
+//  2. patterns, preferring at each segment a literal over :param over *wildcard,
+//     then more segments, then the lexically smaller key
+//
+// The "404" page is rendered when nothing matches. Status pages are never matched by a path.
+
+// Pages a site may define for errors and downtime, rendered with their status code
+const (
+	NotFoundPage    = "404"         // no page matches the path
+	ErrorPage       = "500"         // the page failed to render
+	MaintenancePage = "maintenance" // the site is in maintenance mode, see SiteData.Maintenance
+)
+
+// reserved reports whether a page key is a status page, rendered only for its status
+func reserved(key string) bool {
+	return key == NotFoundPage || key == ErrorPage || key == MaintenancePage
+}
+
+// segment kinds in precedence order
+const (
+	literalSegment = iota
+	paramSegment
+	wildcardSegment
+)
+
+type pattern struct {
+	key      string
+	segments []string
+	kinds    []int
+}
+
+func parsePattern(key string) (*pattern, error) {
+	p := &pattern{key: key}
+	if key == "" {
+		return p, nil
+	}
+	p.segments = strings.Split(key, "/")
+	for i, segment := range p.segments {
+		kind := literalSegment
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			kind = paramSegment
+		case strings.HasPrefix(segment, "*"):
+			kind = wildcardSegment
+			if i != len(p.segments)-1 {
+				return nil, fmt.Errorf("page %s: *%s must be the last segment", key, segment[1:])
+			}
+		}
+		if kind != literalSegment && len(segment) == 1 {
+			return nil, fmt.Errorf("page %s: parameters need a name", key)
+		}
+		if segment == "" {
+			return nil, fmt.Errorf("page %s: empty path segment", key)
+		}
+		p.kinds = append(p.kinds, kind)
+	}
+	return p, nil
+}
+
+// isPattern reports whether a page key captures parameters
+func isPattern(key string) bool {
+	return strings.Contains(key, ":") || strings.Contains(key, "*")
+}
+
+// match returns the parameters captured from path segments, or false
+func (p *pattern) match(segments []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, segment := range p.segments {
+		switch p.kinds[i] {
+		case wildcardSegment:
+			params[segment[1:]] = strings.Join(segments[i:], "/")
+			return params, true
+		case paramSegment:
+			if i >= len(segments) || segments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:]] = segments[i]
+		default:
+			if i >= len(segments) || segments[i] != segment {
+				return nil, false
+			}
+		}
+	}
+	return params, len(segments) == len(p.segments)
+}
+
+// before reports whether p takes precedence over q
+func (p *pattern) before(q *pattern) bool {
+	for i := 0; i < len(p.kinds) && i < len(q.kinds); i++ {
+		if p.kinds[i] != q.kinds[i] {
+			return p.kinds[i] < q.kinds[i]
+		}
+	}
+	if len(p.kinds) != len(q.kinds) {
+		return len(p.kinds) > len(q.kinds)
+	}
+	return p.key < q.key
+}
+
+// MatchPage finds the page for a request path, and the parameters its pattern captured
+func (siteData *SiteData) MatchPage(path string) (string, map[string]string, bool) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		path = "home"
+	}
+	if _, ok := siteData.Pages[path]; ok && !isPattern(path) && !reserved(path) {
+		return path, nil, true
+	}
+
+	var patterns []*pattern
+	for key := range siteData.Pages {
+		if !isPattern(key) {
+			continue
+		}
+		p, err := parsePattern(strings.Trim(key, "/"))
+		if err != nil {
+			continue
+		}
+		p.key = key
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].before(patterns[j]) })
+
+	segments := strings.Split(path, "/")
+	for _, p := range patterns {
+		if params, ok := p.match(segments); ok {
+			return p.key, params, true
+		}
+	}
+	return "", nil, false
+}
+
+// ValidatePages checks that every page key is a valid path pattern
+func (siteData *SiteData) ValidatePages() error {
+	for key := range siteData.Pages {
+		if !isPattern(key) {
+			continue
+		}
+		if _, err := parsePattern(strings.Trim(key, "/")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package pageengine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPage(t *testing.T) {
+	siteData := &SiteData{Pages: map[string]Page{
+		"home":              {},
+		"about":             {},
+		"blog":              {},
+		"blog/:slug":        {},
+		"blog/featured":     {},
+		"blog/:slug/edit":   {},
+		"docs/*path":        {},
+		"users/:id/posts":   {},
+		"users/:name/likes": {},
+		"404":               {},
+		"500":               {},
+		"maintenance":       {},
+	}}
+
+	tests := []struct {
+		path       string
+		wantKey    string
+		wantParams map[string]string
+		wantOK     bool
+	}{
+		{path: "/", wantKey: "home", wantOK: true},
+		{path: "", wantKey: "home", wantOK: true},
+		{path: "/about/", wantKey: "about", wantOK: true},
+		{path: "/blog", wantKey: "blog", wantOK: true},
+		{path: "/blog/featured", wantKey: "blog/featured", wantOK: true},
+		{path: "/blog/hello-world", wantKey: "blog/:slug", wantParams: map[string]string{"slug": "hello-world"}, wantOK: true},
+		{path: "/blog/hello-world/edit", wantKey: "blog/:slug/edit", wantParams: map[string]string{"slug": "hello-world"}, wantOK: true},
+		{path: "/docs", wantKey: "docs/*path", wantParams: map[string]string{"path": ""}, wantOK: true},
+		{path: "/docs/guide/install", wantKey: "docs/*path", wantParams: map[string]string{"path": "guide/install"}, wantOK: true},
+		{path: "/users/7/posts", wantKey: "users/:id/posts", wantParams: map[string]string{"id": "7"}, wantOK: true},
+		{path: "/users/7/likes", wantKey: "users/:name/likes", wantParams: map[string]string{"name": "7"}, wantOK: true},
+		{path: "/blog/a/b/c", wantOK: false},
+		{path: "/contact", wantOK: false},
+		// status pages are only rendered for their status
+		{path: "/404", wantOK: false},
+		{path: "/500", wantOK: false},
+		{path: "/maintenance", wantOK: false},
+		// a path spelling out a pattern key is matched against the patterns like any other
+		{path: "/blog/:slug", wantKey: "blog/:slug", wantParams: map[string]string{"slug": ":slug"}, wantOK: true},
+	}
+	for _, tt := range tests {
+		key, params, ok := siteData.MatchPage(tt.path)
+		if ok != tt.wantOK || key != tt.wantKey {
+			t.Errorf("MatchPage(%q) = %q, %v, want %q, %v", tt.path, key, ok, tt.wantKey, tt.wantOK)
+			continue
+		}
+		if len(params) != 0 || len(tt.wantParams) != 0 {
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("MatchPage(%q) params = %v, want %v", tt.path, params, tt.wantParams)
+			}
+		}
+	}
+}
+
+func TestMatchPagePrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []string
+		path  string
+		want  string
+	}{
+		{"literal before param", []string{"a/:x", "a/b"}, "/a/b", "a/b"},
+		{"param before wildcard", []string{"a/*rest", "a/:x"}, "/a/b", "a/:x"},
+		{"earlier literal wins over later length", []string{"a/:x/c", ":y/b/c"}, "/a/b/c", "a/:x/c"},
+		{"wildcard matches what params can't", []string{"a/:x", "a/*rest"}, "/a/b/c", "a/*rest"},
+		{"equal patterns by key", []string{"a/:y", "a/:x"}, "/a/b", "a/:x"},
+	}
+	for _, tt := range tests {
+		siteData := &SiteData{Pages: map[string]Page{}}
+		for _, key := range tt.pages {
+			siteData.Pages[key] = Page{}
+		}
+		if key, _, _ := siteData.MatchPage(tt.path); key != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, key, tt.want)
+		}
+	}
+}
+
+func TestValidatePages(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "blog/:slug"},
+		{key: "docs/*path"},
+		{key: "/blog/:slug/"},
+		{key: "docs/*path/edit", wantErr: true},
+		{key: "blog/:", wantErr: true},
+		{key: "docs/*", wantErr: true},
+		{key: "blog//:slug", wantErr: true},
+	}
+	for _, tt := range tests {
+		siteData := &SiteData{Pages: map[string]Page{tt.key: {}}}
+		if err := siteData.ValidatePages(); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePages(%q) = %v, want error %v", tt.key, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterAdminRoutes registers instance administration routes, restricted to ADMIN_ADDRESSES
+func RegisterAdminRoutes(e *echo.Echo) {
+	e.GET("/admin/cache", handlers.GetCacheStats, auth.AuthMiddleware, auth.AdminMiddleware) // cache hit/miss/eviction counters
+	e.POST("/admin/sessions/:address/revoke", handlers.AdminRevokeSessions, auth.AuthMiddleware, auth.AdminMiddleware)
+}
@@ -5,6 +5,7 @@ import (
 	"dreamfriday/handlers"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 // RegisterAuthRoutes registers login/logout routes
@@ -14,7 +15,22 @@ func RegisterAuthRoutes(e *echo.Echo) {
 
 	e.GET("/logout", authHandler.Logout)
 	e.POST("/auth/callback", authHandler.AuthCallback)
-	e.GET("/auth/request", authHandler.AuthRequest)
+	// every challenge is stored until it expires, so clients are limited per IP
+	e.GET("/auth/request", authHandler.AuthRequest, middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(handlers.LoginRateLimit)))
+
+	// Other login providers, enabled with AUTH_PROVIDERS
+	e.GET("/auth/providers", authHandler.ListProviders)
+	e.POST("/auth/email/request", authHandler.EmailRequest, middleware.RateLimiter(middleware.NewRateLimiterMemoryStoreWithConfig(
+		middleware.RateLimiterMemoryStoreConfig{Rate: handlers.EmailRateLimit, Burst: handlers.EmailRateBurst},
+	)))
+	e.GET("/auth/email/callback", authHandler.EmailCallback)
+	e.GET("/auth/oidc/login", authHandler.OIDCLogin)
+	e.GET("/auth/oidc/callback", authHandler.OIDCCallback)
+	e.POST("/auth/webauthn/register/begin", authHandler.PasskeyRegisterBegin)
+	e.POST("/auth/webauthn/register/finish", authHandler.PasskeyRegisterFinish)
+	e.POST("/auth/webauthn/login/begin", authHandler.PasskeyLoginBegin)
+	e.POST("/auth/webauthn/login/finish", authHandler.PasskeyLoginFinish)
+	e.POST("/auth/link", authHandler.LinkAccount, auth.AuthMiddleware)
 
 	e.GET("/myaddress", func(c echo.Context) error {
 		addressElement, err := handlers.RouteInternal("/myaddress", c)
@@ -23,4 +39,9 @@ func RegisterAuthRoutes(e *echo.Echo) {
 		}
 		return c.JSON(200, addressElement)
 	}, auth.AuthMiddleware)
+
+	// ENS lookups
+	// each lookup can reach the chain, so clients are limited per IP
+	e.GET("/resolve/:name", handlers.ResolveName, middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(handlers.ResolveRateLimit)))
+	e.GET("/name/:address", handlers.ReverseName)
 }
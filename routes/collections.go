@@ -0,0 +1,19 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func RegisterCollectionRoutes(e *echo.Echo) {
+	e.GET("/collection/:name", handlers.GetCollection) // json published records
+
+	// preview only, record edits are saved to the draft
+	previewHandler := handlers.NewPreviewHandler()
+	e.GET("/preview/collections", previewHandler.GetCollections, auth.RequireScope(auth.ScopeReadPreview))
+	e.GET("/preview/collection/:name/:slug", previewHandler.GetRecord, auth.RequireScope(auth.ScopeReadPreview))
+	e.POST("/preview/collection/:name/:slug", previewHandler.PutRecord, auth.RequireScope(auth.ScopeWritePreview))
+	e.DELETE("/preview/collection/:name/:slug", previewHandler.DeleteRecord, auth.RequireScope(auth.ScopeWritePreview))
+}
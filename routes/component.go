@@ -1,6 +1,7 @@
 package routes
 
 import (
+	auth "dreamfriday/auth"
 	"dreamfriday/handlers"
 
 	"github.com/labstack/echo/v4"
@@ -18,7 +19,7 @@ func RegisterComponentRoutes(e *echo.Echo) {
 	}) // get preview component by name for current domain
 	// preview
 	previewHandler := handlers.NewPreviewHandler()
-	e.GET("/preview/components", previewHandler.GetComponents) // get all preview component for current domain
+	e.GET("/preview/components", previewHandler.GetComponents, auth.RequireScope(auth.ScopeReadPreview)) // get all preview component for current domain
 
 	e.GET("/preview/component/:name", func(c echo.Context) error {
 		pageElement, err := previewHandler.GetComponent(c, "")
@@ -26,6 +27,6 @@ func RegisterComponentRoutes(e *echo.Echo) {
 			return c.JSON(500, err)
 		}
 		return c.JSON(200, pageElement)
-	}) // get preview component by name for current domain
+	}, auth.RequireScope(auth.ScopeReadPreview)) // get preview component by name for current domain
 
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterMemberRoutes registers site collaborator routes, for the site of the request's host
+func RegisterMemberRoutes(e *echo.Echo) {
+	e.GET("/members", handlers.ListMembers, auth.AuthMiddleware)
+	e.POST("/members/invite", handlers.InviteMember, auth.AuthMiddleware) // owner only
+	e.POST("/members/accept", handlers.AcceptInvitation, auth.AuthMiddleware)
+	e.POST("/members/:handle/remove", handlers.RemoveMember, auth.AuthMiddleware) // owner, or a member leaving
+}
@@ -11,7 +11,7 @@ func RegisterPageRoutes(e *echo.Echo) {
 
 	// renders preview or production pages based on c.data set in middleware
 	e.GET("/", handlers.RenderPage)
-	e.GET("/:pageName", handlers.RenderPage)
+	e.GET("/*", handlers.RenderPage) // page names, collection records and page path patterns
 
 	// production only
 	e.GET("/page/:pageName", handlers.GetPage) // json page data
@@ -19,7 +19,7 @@ func RegisterPageRoutes(e *echo.Echo) {
 
 	// preview only
 	previewHandler := handlers.NewPreviewHandler()
-	e.GET("/preview/page/:pageName", previewHandler.GetPage) // json page data
+	e.GET("/preview/page/:pageName", previewHandler.GetPage, auth.RequireScope(auth.ScopeReadPreview)) // json page data
 
 	e.GET("/preview/pages", func(c echo.Context) error {
 		pages, err := previewHandler.GetPages(c)
@@ -27,8 +27,8 @@ func RegisterPageRoutes(e *echo.Echo) {
 			return c.JSON(500, err.Error())
 		}
 		return c.JSON(200, pages)
-	})
+	}, auth.RequireScope(auth.ScopeReadPreview))
 
-	e.POST("/preview/page/:pageName", previewHandler.UpdatePage, auth.AuthMiddleware) // update preview element
+	e.POST("/preview/page/:pageName", previewHandler.UpdatePage, auth.RequireScope(auth.ScopeWritePreview)) // update preview element
 
 }
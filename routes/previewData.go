@@ -10,8 +10,8 @@ import (
 func RegisterPreviewRoutes(e *echo.Echo) {
 	previewHandler := handlers.NewPreviewHandler()
 
-	e.GET("/preview", previewHandler.TogglePreviewMode)            // get preview data
-	e.POST("/preview", previewHandler.Update, auth.AuthMiddleware) // update preview data
+	e.GET("/preview", previewHandler.TogglePreviewMode)                                  // get preview data
+	e.POST("/preview", previewHandler.Update, auth.RequireScope(auth.ScopeWritePreview)) // update preview data
 
 	e.GET("/preview/json", func(c echo.Context) error {
 		previewData, err := previewHandler.GetSiteData(c)
@@ -19,8 +19,8 @@ func RegisterPreviewRoutes(e *echo.Echo) {
 			return c.JSON(500, err)
 		}
 		return c.JSON(200, previewData.SiteData)
-	}, auth.AuthMiddleware) // get preview data
+	}, auth.RequireScope(auth.ScopeReadPreview)) // get preview data
 
-	e.GET("/preview/element/:pid", previewHandler.GetElement, auth.AuthMiddleware)     // get preview element
-	e.POST("/preview/element/:pid", previewHandler.UpdateElement, auth.AuthMiddleware) // update preview element
+	e.GET("/preview/element/:pid", previewHandler.GetElement, auth.RequireScope(auth.ScopeReadPreview))      // get preview element
+	e.POST("/preview/element/:pid", previewHandler.UpdateElement, auth.RequireScope(auth.ScopeWritePreview)) // update preview element
 }
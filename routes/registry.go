@@ -0,0 +1,15 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterRegistryRoutes registers on-chain SiteRegistry routes, for the site of the request's host
+func RegisterRegistryRoutes(e *echo.Echo) {
+	e.GET("/registry/tx", handlers.GetRegistryTx, auth.RequireScope(auth.ScopePublish))       // unsigned setSite call for the published CID
+	e.POST("/registry/relay", handlers.RelayRegistryTx, auth.RequireScope(auth.ScopePublish)) // broadcasts the signed call
+	e.GET("/verify", handlers.VerifySite)
+}
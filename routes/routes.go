@@ -4,8 +4,14 @@ import "github.com/labstack/echo/v4"
 
 func RegisterRoutes(e *echo.Echo) {
 	RegisterAuthRoutes(e)       // Authentication route
+	RegisterSessionRoutes(e)    // Session route
+	RegisterTokenRoutes(e)      // API token route
+	RegisterMemberRoutes(e)     // Site collaborator route
 	RegisterPreviewRoutes(e)    // Preview route
 	RegisterProductionRoutes(e) // Data route
+	RegisterRegistryRoutes(e)   // On-chain registry route
 	RegisterPageRoutes(e)       // Page route
 	RegisterComponentRoutes(e)  // Component route
+	RegisterCollectionRoutes(e) // Collection route
+	RegisterAdminRoutes(e)      // Admin route
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterSessionRoutes registers the device list and session revocation routes
+func RegisterSessionRoutes(e *echo.Echo) {
+	e.GET("/sessions", handlers.ListSessions, auth.AuthMiddleware)
+	e.POST("/sessions/revoke-all", handlers.RevokeAllSessions, auth.AuthMiddleware) // log out everywhere
+	e.POST("/sessions/:id/revoke", handlers.RevokeSession, auth.AuthMiddleware)
+}
@@ -25,8 +25,11 @@ func RegisterProductionRoutes(e *echo.Echo) {
 		return c.JSON(200, sites)
 	}, auth.AuthMiddleware)
 
+	// session only: API tokens are scoped to existing sites, so none can cover a site that doesn't exist yet
 	e.POST("/create", handlers.CreateSite, auth.AuthMiddleware)
-	e.POST("/publish", handlers.PublishSite, auth.AuthMiddleware)
+	e.GET("/publish/manifest", handlers.GetPublishManifest, auth.RequireScope(auth.ScopePublish)) // manifest to sign before publishing
+	e.POST("/publish", handlers.PublishSite, auth.RequireScope(auth.ScopePublish))
+	e.GET("/versions", handlers.ListVersions) // public, signed publish history
 
 	e.GET("/cid", func(c echo.Context) error {
 		sites, err := handlers.RouteInternal("/cid", c)
@@ -36,5 +39,8 @@ func RegisterProductionRoutes(e *echo.Echo) {
 		return c.JSON(200, sites)
 	})
 
-	//e.POST("/delete", handlers.DeleteSite, auth.AuthMiddleware)
+	// owner only, addressed by name so a deleted site can still be restored
+	e.POST("/sites/:name/transfer", handlers.TransferSite, auth.AuthMiddleware)
+	e.POST("/sites/:name/delete", handlers.DeleteSite, auth.AuthMiddleware)
+	e.POST("/sites/:name/restore", handlers.RestoreSite, auth.AuthMiddleware)
 }
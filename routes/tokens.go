@@ -0,0 +1,16 @@
+package routes
+
+import (
+	auth "dreamfriday/auth"
+	handlers "dreamfriday/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterTokenRoutes registers API token management. Tokens are managed from a
+// logged in session only, a token can't issue more tokens.
+func RegisterTokenRoutes(e *echo.Echo) {
+	e.GET("/tokens", handlers.ListTokens, auth.AuthMiddleware)
+	e.POST("/tokens", handlers.CreateToken, auth.AuthMiddleware)
+	e.POST("/tokens/:id/revoke", handlers.RevokeToken, auth.AuthMiddleware)
+}
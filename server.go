@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"html/template"
 	"io"
@@ -8,15 +9,22 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
 
 	ipfs "dreamfriday/IPFS"
 	auth "dreamfriday/auth"
+	"dreamfriday/cache"
 	"dreamfriday/database"
+	"dreamfriday/ethereum"
+	"dreamfriday/handlers"
 	Middleware "dreamfriday/middleware"
 	"dreamfriday/models"
 	"dreamfriday/pageengine"
@@ -40,16 +48,75 @@ func init() {
 
 	// Initialize IPFS
 
-	IPFS_URL := os.Getenv("IPFS_URL")
-	if IPFS_URL == "" {
-		IPFS_URL = "http://localhost:5001"
-	}
-	if err := ipfs.InitManager(IPFS_URL); err != nil {
+	// IPFS_URL and IPFS_GATEWAYS accept comma separated lists for failover
+	if err := ipfs.InitManager(ipfs.ConfigFromEnv()); err != nil {
 		log.Fatalf("Failed to initialize IPFS manager: %v", err)
 	}
 
 	ipfs.GetVersion()
 
+	// per client requests per second for /resolve/:name
+	if limit, err := strconv.ParseFloat(os.Getenv("RESOLVE_RATE_LIMIT"), 64); err == nil && limit > 0 {
+		handlers.ResolveRateLimit = rate.Limit(limit)
+	}
+
+	// per client requests per second for /auth/request
+	if limit, err := strconv.ParseFloat(os.Getenv("LOGIN_RATE_LIMIT"), 64); err == nil && limit > 0 {
+		handlers.LoginRateLimit = rate.Limit(limit)
+	}
+
+	// per client magic links per minute for /auth/email/request
+	if limit, err := strconv.ParseFloat(os.Getenv("EMAIL_RATE_LIMIT"), 64); err == nil && limit > 0 {
+		handlers.EmailRateLimit = rate.Limit(limit / 60)
+	}
+
+	// optional chain access, used to verify contract wallet (ERC-1271) signatures
+	if ETH_RPC_URL := os.Getenv("ETH_RPC_URL"); ETH_RPC_URL != "" {
+		if err := ethereum.Init(ETH_RPC_URL); err != nil {
+			log.Fatalf("Failed to connect to chain: %v", err)
+		}
+
+		// ENS names for handles and site owners
+		registry := ethereum.ENSRegistryAddress
+		if ENS_REGISTRY := os.Getenv("ENS_REGISTRY"); ENS_REGISTRY != "" {
+			registry = common.HexToAddress(ENS_REGISTRY)
+		}
+		ensTTL, err := time.ParseDuration(os.Getenv("ENS_CACHE_TTL"))
+		if err != nil || ensTTL <= 0 {
+			ensTTL = 15 * time.Minute
+		}
+		ethereum.NameResolver = ethereum.NewCachedResolver(ethereum.NewENSResolver(ethereum.Reader, registry), ensTTL)
+
+		// token balances for gated pages
+		balanceTTL, err := time.ParseDuration(os.Getenv("TOKEN_GATE_CACHE_TTL"))
+		if err != nil || balanceTTL <= 0 {
+			balanceTTL = time.Minute
+		}
+		ethereum.Balances = ethereum.NewCachedBalanceChecker(ethereum.NewChainBalanceChecker(ethereum.Reader), balanceTTL)
+
+		// optional on-chain record of each site's published CID
+		if SITE_REGISTRY_ADDRESS := os.Getenv("SITE_REGISTRY_ADDRESS"); SITE_REGISTRY_ADDRESS != "" {
+			if !common.IsHexAddress(SITE_REGISTRY_ADDRESS) {
+				log.Fatalf("Invalid SITE_REGISTRY_ADDRESS %q", SITE_REGISTRY_ADDRESS)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := ethereum.InitRegistry(ctx, common.HexToAddress(SITE_REGISTRY_ADDRESS))
+			cancel()
+			if err != nil {
+				log.Fatalf("Failed to initialize site registry: %v", err)
+			}
+
+			// serve production data from the CID the owner registered on chain, rather than trusting Bolt
+			if os.Getenv("SITE_REGISTRY_RESOLVE") == "true" {
+				blockTTL, err := time.ParseDuration(os.Getenv("SITE_REGISTRY_BLOCK_TTL"))
+				if err != nil || blockTTL <= 0 {
+					blockTTL = 5 * time.Second
+				}
+				ethereum.SiteCIDs = ethereum.NewRegistryResolver(ethereum.Registry, blockTTL)
+			}
+		}
+	}
+
 }
 
 type TemplateRegistry struct {
@@ -101,6 +168,26 @@ func main() {
 	}
 	defer database.Close()
 
+	// share caches between instances when running behind a load balancer
+	if REDIS_URL := os.Getenv("REDIS_URL"); REDIS_URL != "" {
+		if err := cache.UseRedis(REDIS_URL, handlers.CacheCodecs()); err != nil {
+			log.Fatalf("Failed to initialize shared cache: %v", err)
+		}
+	}
+
+	// serve sites from the last known good snapshot even if IPFS is down at startup
+	go handlers.WarmSiteDataCache()
+
+	// purge deleted sites once their grace period is over
+	if SITE_DELETE_GRACE := os.Getenv("SITE_DELETE_GRACE"); SITE_DELETE_GRACE != "" {
+		grace, err := time.ParseDuration(SITE_DELETE_GRACE)
+		if err != nil {
+			log.Fatalf("Invalid SITE_DELETE_GRACE %q: %v", SITE_DELETE_GRACE, err)
+		}
+		handlers.SiteDeleteGrace = grace
+	}
+	go handlers.SweepDeletedSites(10 * time.Minute)
+
 	// BootStrapSite()
 
 	e := echo.New()
@@ -119,6 +206,7 @@ func main() {
 	e.Use(Middleware.LoadSiteDataMiddleware)
 
 	auth.InitSessionStore()
+	auth.InitProviders()
 
 	routes.RegisterRoutes(e)
 
@@ -20,6 +20,37 @@ function manage() {
     })
 }
 
+// publishes the preview after the user's wallet signs a manifest for it
+async function publishSigned() {
+    const messageElement = document.getElementById('message');
+    try {
+        const accounts = await ethereum.request({ method: "eth_requestAccounts" });
+        const signer = accounts[0];
+
+        const response = await fetch(`${BASE_URL}/publish/manifest`);
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        const { manifest, message } = await response.json();
+
+        manifest.signer = signer;
+        manifest.signature = await ethereum.request({
+            method: "personal_sign",
+            params: [message, signer],
+        });
+
+        const publishResponse = await fetch(`${BASE_URL}/publish`, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(manifest),
+        });
+        messageElement.textContent = await publishResponse.text();
+    } catch (error) {
+        console.error('Error publishing:', error);
+        messageElement.textContent = `Error: ${error.message}`;
+    }
+}
+
 async function getPreviewData(callback) {
     try {
         const response = await fetch(`${BASE_URL}/preview/json`);